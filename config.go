@@ -7,6 +7,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,14 +19,33 @@ import (
 // Config is the configuration of the Server.
 type Config struct {
 	sync.Mutex
-	name         string
-	Provider     *RegistrationProvider      `json:"provider" yaml:"provider"`
-	Record       *record.RegistrationRecord `json:"record" yaml:"record"`
-	SyncInterval uint64                     `json:"sync_interval" yaml:"sync_interval"`
-	LogLevel     string                     `json:"log_level" yaml:"log_level"`
-	File         string                     `json:"conf_file" yaml:"conf_file"`
+	name           string
+	Provider       *RegistrationProvider            `json:"provider,omitempty" yaml:"provider,omitempty"`
+	Providers      map[string]*RegistrationProvider `json:"providers,omitempty" yaml:"providers,omitempty"`
+	Record         *record.RegistrationRecord       `json:"record,omitempty" yaml:"record,omitempty"`
+	Records        []*record.RegistrationRecord     `json:"records,omitempty" yaml:"records,omitempty"`
+	AddressSources []*AddressSource                 `json:"address_sources,omitempty" yaml:"address_sources,omitempty"`
+	AddressQuorum  uint64                           `json:"address_quorum,omitempty" yaml:"address_quorum,omitempty"`
+	Gateway        *GatewayConfig                   `json:"gateway,omitempty" yaml:"gateway,omitempty"`
+	Watch          *WatchConfig                     `json:"watch,omitempty" yaml:"watch,omitempty"`
+	Resolver       *ResolverConfig                  `json:"resolver,omitempty" yaml:"resolver,omitempty"`
+	Lookup         string                           `json:"lookup,omitempty" yaml:"lookup,omitempty"`
+	SyncInterval   uint64                           `json:"sync_interval" yaml:"sync_interval"`
+	LogLevel       string                           `json:"log_level" yaml:"log_level"`
+	File           string                           `json:"conf_file" yaml:"conf_file"`
 }
 
+// defaultProviderName is the name of the provider configured with
+// the provider key.
+const defaultProviderName = "default"
+
+// The sources of the addresses of the registered records compared to the
+// public address of the host.
+const (
+	lookupDNS      = "dns"
+	lookupProvider = "provider"
+)
+
 // LoadConfig loads configuration of the Server from a file.
 func (s *Server) LoadConfig(configFile string) error {
 	var configType string
@@ -81,20 +101,48 @@ func (s *Server) LoadConfig(configFile string) error {
 		s.cfg.SyncInterval = 60
 	}
 
-	if s.cfg.Provider == nil {
-		return fmt.Errorf("dns provider failed to initialize due to invalid configuration")
+	// The single provider key is an alias for the provider named default.
+	if s.cfg.Provider != nil {
+		if s.cfg.Providers == nil {
+			s.cfg.Providers = make(map[string]*RegistrationProvider)
+		}
+		if _, exists := s.cfg.Providers[defaultProviderName]; exists {
+			return fmt.Errorf("%s: dns provider %s is defined in both provider and providers", s.name, defaultProviderName)
+		}
+		s.cfg.Providers[defaultProviderName] = s.cfg.Provider
 	}
 
-	if err := s.cfg.Provider.Validate(); err != nil {
-		return fmt.Errorf("%s: invalid dns provider definition, error: %s", s.name, err.Error())
+	if err := s.cfg.validateProviders(); err != nil {
+		return fmt.Errorf("%s: %s", s.name, err.Error())
 	}
 
-	if s.cfg.Record == nil {
-		return fmt.Errorf("dns record failed to initialize due to invalid configuration")
+	// The single record key is an alias for a list with one record.
+	if s.cfg.Record != nil {
+		s.cfg.Records = append([]*record.RegistrationRecord{s.cfg.Record}, s.cfg.Records...)
+	}
+
+	if err := s.cfg.validateRecords(); err != nil {
+		return fmt.Errorf("%s: %s", s.name, err.Error())
+	}
+
+	if err := s.cfg.validateAddressSources(); err != nil {
+		return fmt.Errorf("%s: %s", s.name, err.Error())
+	}
+
+	if s.cfg.Gateway != nil {
+		if err := s.cfg.Gateway.validate(s.cfg); err != nil {
+			return fmt.Errorf("%s: invalid gateway definition, error: %s", s.name, err.Error())
+		}
+	}
+
+	if s.cfg.Resolver != nil {
+		if err := s.cfg.Resolver.validate(); err != nil {
+			return fmt.Errorf("%s: invalid resolver definition, error: %s", s.name, err.Error())
+		}
 	}
 
-	if err := s.cfg.Record.Validate(); err != nil {
-		return fmt.Errorf("%s: invalid dns record definition, error: %s", s.name, err.Error())
+	if err := validateLookup(s.cfg.Lookup); err != nil {
+		return fmt.Errorf("%s: %s", s.name, err)
 	}
 
 	return nil
@@ -109,29 +157,144 @@ func (s *Server) ValidateConfig() error {
 		return fmt.Errorf("%s: sync interval is null", s.name)
 	}
 
-	if s.cfg.Provider == nil {
-		return fmt.Errorf("%s: dns provider failed to initialize due to invalid configuration", s.name)
+	if err := s.cfg.validateProviders(); err != nil {
+		return fmt.Errorf("%s: %s", s.name, err.Error())
+	}
+
+	for _, name := range s.cfg.getProviderNames() {
+		if err := s.cfg.Providers[name].Configure(s.log.With(zap.String("provider", name))); err != nil {
+			return fmt.Errorf("%s: dns provider %s configuration error: %s", s.name, name, err.Error())
+		}
+	}
+
+	if err := s.cfg.validateRecords(); err != nil {
+		return fmt.Errorf("%s: %s", s.name, err.Error())
+	}
+
+	if err := s.cfg.validateAddressSources(); err != nil {
+		return fmt.Errorf("%s: %s", s.name, err.Error())
 	}
 
-	if err := s.cfg.Provider.Validate(); err != nil {
-		return fmt.Errorf("%s: invalid dns provider definition, error: %s", s.name, err.Error())
+	for i, source := range s.cfg.AddressSources {
+		if err := source.Configure(s.log.With(zap.String("address_source", source.GetSource()))); err != nil {
+			return fmt.Errorf("%s: address source %d configuration error: %s", s.name, i, err.Error())
+		}
 	}
 
-	if err := s.cfg.Provider.Configure(s.log); err != nil {
-		return fmt.Errorf("%s: dns provider configuration error: %s", s.name, err.Error())
+	if s.cfg.Gateway != nil {
+		if err := s.cfg.Gateway.validate(s.cfg); err != nil {
+			return fmt.Errorf("%s: invalid gateway definition, error: %s", s.name, err.Error())
+		}
 	}
 
-	if s.cfg.Record == nil {
-		return fmt.Errorf("%s: dns record failed to initialize due to invalid configuration", s.name)
+	if s.cfg.Resolver != nil {
+		if err := s.cfg.Resolver.validate(); err != nil {
+			return fmt.Errorf("%s: invalid resolver definition, error: %s", s.name, err.Error())
+		}
 	}
 
-	if err := s.cfg.Record.Validate(); err != nil {
-		return fmt.Errorf("%s: invalid dns record definition, error: %s", s.name, err.Error())
+	if err := validateLookup(s.cfg.Lookup); err != nil {
+		return fmt.Errorf("%s: %s", s.name, err)
 	}
 
 	return nil
 }
 
+// validateLookup validates the lookup of DNS records.
+func validateLookup(lookup string) error {
+	switch lookup {
+	case "", lookupDNS, lookupProvider:
+		return nil
+	}
+	return fmt.Errorf("invalid lookup %s, must be one of the following: dns, provider", lookup)
+}
+
+// validateProviders validates DNS providers.
+func (cfg *Config) validateProviders() error {
+	if len(cfg.Providers) == 0 {
+		return fmt.Errorf("dns provider failed to initialize due to invalid configuration")
+	}
+	for _, name := range cfg.getProviderNames() {
+		p := cfg.Providers[name]
+		if p == nil {
+			return fmt.Errorf("dns provider %s failed to initialize due to invalid configuration", name)
+		}
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("invalid dns provider %s definition, error: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+// getProviderNames returns sorted names of DNS providers.
+func (cfg *Config) getProviderNames() []string {
+	names := []string{}
+	for name := range cfg.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateRecords validates DNS records and their provider references.
+func (cfg *Config) validateRecords() error {
+	// The records are optional when the service acts as a gateway only.
+	if len(cfg.Records) == 0 && cfg.Gateway == nil {
+		return fmt.Errorf("dns record failed to initialize due to invalid configuration")
+	}
+
+	seen := make(map[string]bool)
+	for i, r := range cfg.Records {
+		if r == nil {
+			return fmt.Errorf("dns record %d failed to initialize due to invalid configuration", i)
+		}
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("invalid dns record definition, error: %s", err.Error())
+		}
+		name, err := cfg.resolveProviderName(r.Provider)
+		if err != nil {
+			return fmt.Errorf("invalid dns record %s definition, error: %s", r.Name, err.Error())
+		}
+		r.Provider = name
+		k := r.Name + "/" + r.Provider
+		if seen[k] {
+			return fmt.Errorf("duplicate dns record %s definition", r.Name)
+		}
+		seen[k] = true
+	}
+	return nil
+}
+
+// resolveProviderName returns the name of the provider referenced by a
+// record. An empty reference resolves to the default provider, or to the
+// only provider when a single provider is configured.
+func (cfg *Config) resolveProviderName(name string) (string, error) {
+	if name != "" {
+		if _, exists := cfg.Providers[name]; !exists {
+			return "", fmt.Errorf("dns provider %s not found", name)
+		}
+		return name, nil
+	}
+	if _, exists := cfg.Providers[defaultProviderName]; exists {
+		return defaultProviderName, nil
+	}
+	if len(cfg.Providers) == 1 {
+		for name := range cfg.Providers {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("dns provider reference is required when multiple providers are configured")
+}
+
+// getProvider returns the provider referenced by the provided name.
+func (cfg *Config) getProvider(name string) (*RegistrationProvider, error) {
+	name, err := cfg.resolveProviderName(name)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Providers[name], nil
+}
+
 // GetConfig returns an instance of Config.
 func (s *Server) GetConfig() *Config {
 	return s.cfg
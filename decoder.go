@@ -0,0 +1,38 @@
+package dyndns
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// decodeTyped decodes polymorphic configuration, i.e. configuration whose
+// structure depends on its type field. The unmarshal function decodes the
+// configuration into the provided value. It is either backed by JSON or
+// it is the function yaml.v2 passes to UnmarshalYAML. The type field is
+// decoded first, then newFn creates an instance for the type and the
+// configuration is decoded into it.
+func decodeTyped[T any](kind string, unmarshal func(interface{}) error, newFn func(string) (T, error)) (string, T, error) {
+	var instance T
+	header := struct {
+		Type string `json:"type" yaml:"type"`
+	}{}
+	if err := unmarshal(&header); err != nil {
+		return "", instance, fmt.Errorf("invalid %s configuration, error: %s", kind, err)
+	}
+	instance, err := newFn(header.Type)
+	if err != nil {
+		return "", instance, err
+	}
+	if err := unmarshal(instance); err != nil {
+		return "", instance, fmt.Errorf("invalid %s %s configuration, error: %s", header.Type, kind, err)
+	}
+	return header.Type, instance, nil
+}
+
+// jsonUnmarshaler returns a function decoding the provided JSON
+// configuration for decodeTyped.
+func jsonUnmarshaler(data []byte) func(interface{}) error {
+	return func(v interface{}) error {
+		return json.Unmarshal(data, v)
+	}
+}
@@ -0,0 +1,430 @@
+package dyndns
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/record"
+	"github.com/miekg/dns"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultGatewayAddress = ":8080"
+	// maxGatewayHostnames is the maximum number of hostnames in a single
+	// update request.
+	maxGatewayHostnames = 20
+)
+
+// GatewayConfig is the configuration of the dyndns2 compatible update
+// server. The server accepts updates from the clients, e.g. routers and
+// NAS devices, and registers the records with the configured providers.
+type GatewayConfig struct {
+	Listen      string           `json:"listen,omitempty" yaml:"listen,omitempty"`
+	TLSCertFile string           `json:"tls_cert_file,omitempty" yaml:"tls_cert_file,omitempty"`
+	TLSKeyFile  string           `json:"tls_key_file,omitempty" yaml:"tls_key_file,omitempty"`
+	Clients     []*GatewayClient `json:"clients" yaml:"clients"`
+}
+
+// GatewayClient is a client authorized to update the provided hostnames.
+// The addresses sent by the client are checked against the address policy,
+// by default rejecting the addresses not routable on the public Internet.
+type GatewayClient struct {
+	Username   string                `json:"username" yaml:"username"`
+	Password   string                `json:"-" yaml:"password"`
+	Hostnames  []string              `json:"hostnames" yaml:"hostnames"`
+	Provider   string                `json:"provider,omitempty" yaml:"provider,omitempty"`
+	TimeToLive uint64                `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	Policy     *record.AddressPolicy `json:"policy,omitempty" yaml:"policy,omitempty"`
+}
+
+// UnmarshalJSON unpacks client configuration. The password is not
+// packed back into JSON to keep it out of the logs.
+func (c *GatewayClient) UnmarshalJSON(data []byte) error {
+	type config GatewayClient
+	v := &struct {
+		*config
+		Password string `json:"password"`
+	}{config: (*config)(c)}
+	if err := jsonUnmarshaler(data)(v); err != nil {
+		return err
+	}
+	c.Password = v.Password
+	return nil
+}
+
+// validate validates gateway configuration.
+func (g *GatewayConfig) validate(cfg *Config) error {
+	if g.Listen == "" {
+		g.Listen = defaultGatewayAddress
+	}
+	if (g.TLSCertFile == "") != (g.TLSKeyFile == "") {
+		return fmt.Errorf("gateway tls certificate and key files must be provided together")
+	}
+	if len(g.Clients) == 0 {
+		return fmt.Errorf("gateway has no clients")
+	}
+	usernames := make(map[string]bool)
+	for i, c := range g.Clients {
+		if c == nil || c.Username == "" {
+			return fmt.Errorf("gateway client %d has no username", i)
+		}
+		if usernames[c.Username] {
+			return fmt.Errorf("duplicate gateway client %s", c.Username)
+		}
+		usernames[c.Username] = true
+		if c.Password == "" {
+			return fmt.Errorf("gateway client %s has no password", c.Username)
+		}
+		if len(c.Hostnames) == 0 {
+			return fmt.Errorf("gateway client %s has no hostnames", c.Username)
+		}
+		for j, hostname := range c.Hostnames {
+			if !isGatewayHostname(hostname) {
+				return fmt.Errorf("gateway client %s hostname %s is not a fully-qualified domain name", c.Username, hostname)
+			}
+			c.Hostnames[j] = strings.ToLower(strings.TrimSuffix(hostname, "."))
+		}
+		name, err := cfg.resolveProviderName(c.Provider)
+		if err != nil {
+			return fmt.Errorf("gateway client %s: %s", c.Username, err)
+		}
+		c.Provider = name
+		if c.TimeToLive == 0 {
+			c.TimeToLive = 60
+		}
+		if c.Policy == nil {
+			c.Policy = &record.AddressPolicy{RejectSpecial: true}
+		}
+		if err := c.Policy.Validate(); err != nil {
+			return fmt.Errorf("gateway client %s address policy is invalid: %s", c.Username, err)
+		}
+	}
+	return nil
+}
+
+func isGatewayHostname(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	if _, ok := dns.IsDomainName(s); !ok {
+		return false
+	}
+	return strings.Contains(s, ".")
+}
+
+// gateway is the HTTP handler of the dyndns2 compatible update server.
+type gateway struct {
+	cfg         *GatewayConfig
+	log         *zap.Logger
+	getProvider func(string) (*RegistrationProvider, error)
+
+	// mu guards the records map only. The updates of a record are
+	// serialized by the mutex of the record, so a slow provider does not
+	// block the updates of other hostnames.
+	mu      sync.Mutex
+	records map[string]*gatewayRecord
+}
+
+// gatewayRecord is a record updated by the gateway clients. The mutex is
+// held from the status check to the status update, so the concurrent
+// updates of the record are registered one at a time.
+type gatewayRecord struct {
+	mu     sync.Mutex
+	record *record.RegistrationRecord
+}
+
+func newGateway(s *Server) *gateway {
+	return &gateway{
+		cfg:         s.cfg.Gateway,
+		log:         s.log,
+		getProvider: s.cfg.getProvider,
+		records:     make(map[string]*gatewayRecord),
+	}
+}
+
+// authenticate returns the client matching the credentials of the request.
+func (g *gateway) authenticate(r *http.Request) *GatewayClient {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil
+	}
+	for _, c := range g.cfg.Clients {
+		if c.Username != username {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(c.Password), []byte(password)) == 1 {
+			return c
+		}
+		return nil
+	}
+	return nil
+}
+
+// getRecord returns the record of the hostname registered by the client.
+func (g *gateway) getRecord(c *GatewayClient, hostname string) *gatewayRecord {
+	k := c.Provider + "/" + hostname
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	entry, exists := g.records[k]
+	if !exists {
+		r := &record.RegistrationRecord{
+			Name:       hostname,
+			Type:       "ALL",
+			TimeToLive: c.TimeToLive,
+			Provider:   c.Provider,
+		}
+		r.Validate()
+		entry = &gatewayRecord{record: r}
+		g.records[k] = entry
+	}
+	return entry
+}
+
+// parseAddresses returns the addresses from the myip parameter, falling
+// back to the address of the client.
+func parseGatewayAddresses(r *http.Request) (map[int]string, error) {
+	addrs := make(map[int]string)
+	myip := r.URL.Query().Get("myip")
+	if myip == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		myip = host
+	}
+	for _, s := range strings.Split(myip, ",") {
+		ip := net.ParseIP(strings.TrimSpace(s))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip address %q", s)
+		}
+		version := 6
+		if ip.To4() != nil {
+			version = 4
+		}
+		if _, exists := addrs[version]; exists {
+			return nil, fmt.Errorf("multiple ip version %d addresses", version)
+		}
+		addrs[version] = ip.String()
+	}
+	return addrs, nil
+}
+
+// ServeHTTP handles dyndns2 update requests. The response contains one
+// line per hostname.
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	if r.URL.Path != "/nic/update" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet || r.UserAgent() == "" {
+		fmt.Fprint(w, "badagent")
+		return
+	}
+
+	c := g.authenticate(r)
+	if c == nil {
+		g.log.Warn(
+			"gateway client authentication failed",
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("user_agent", r.UserAgent()),
+		)
+		w.Header().Set("WWW-Authenticate", `Basic realm="dyndns"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "badauth")
+		return
+	}
+
+	hostnames := strings.Split(r.URL.Query().Get("hostname"), ",")
+	if len(hostnames) > maxGatewayHostnames {
+		fmt.Fprint(w, "numhost")
+		return
+	}
+
+	addrs, err := parseGatewayAddresses(r)
+	if err != nil {
+		g.log.Warn(
+			"gateway client sent invalid address",
+			zap.String("username", c.Username),
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("error", err.Error()),
+		)
+		fmt.Fprint(w, "badagent")
+		return
+	}
+
+	responses := []string{}
+	for _, hostname := range hostnames {
+		responses = append(responses, g.update(c, hostname, addrs))
+	}
+	fmt.Fprint(w, strings.Join(responses, "\n"))
+}
+
+// update registers the addresses of a hostname and returns the response
+// code for the hostname.
+func (g *gateway) update(c *GatewayClient, hostname string, addrs map[int]string) string {
+	hostname = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(hostname), "."))
+	if !isGatewayHostname(hostname) {
+		return "notfqdn"
+	}
+	var authorized bool
+	for _, h := range c.Hostnames {
+		if h == hostname {
+			authorized = true
+			break
+		}
+	}
+	if !authorized {
+		g.log.Warn(
+			"gateway client is not authorized to update hostname",
+			zap.String("username", c.Username),
+			zap.String("hostname", hostname),
+		)
+		return "nohost"
+	}
+
+	provider, err := g.getProvider(c.Provider)
+	if err != nil {
+		g.log.Error(
+			"gateway dns provider not found",
+			zap.String("username", c.Username),
+			zap.String("hostname", hostname),
+			zap.String("error", err.Error()),
+		)
+		return "dnserr"
+	}
+
+	for _, version := range []int{4, 6} {
+		addr, exists := addrs[version]
+		if !exists {
+			continue
+		}
+		if err := c.Policy.Check(addr); err != nil {
+			g.log.Warn(
+				"gateway client address rejected by policy",
+				zap.String("username", c.Username),
+				zap.String("hostname", hostname),
+				zap.Int("ip_version", version),
+				zap.String("address", addr),
+				zap.String("error", err.Error()),
+			)
+			return "dnserr"
+		}
+	}
+
+	entry := g.getRecord(c, hostname)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	r := entry.record
+	// The provider registers a copy of the record holding the addresses of
+	// this request. The outcome is stored in the status of the record.
+	update := &record.RegistrationRecord{
+		Name:       r.Name,
+		Type:       r.Type,
+		TimeToLive: r.TimeToLive,
+		Provider:   r.Provider,
+	}
+	update.Validate()
+
+	code := "nochg"
+	values := []string{}
+	for _, version := range []int{4, 6} {
+		addr, exists := addrs[version]
+		if !exists {
+			continue
+		}
+		values = append(values, addr)
+		if status := r.GetStatus(version); status != nil && status.State != record.StateFailed && status.Address == addr {
+			continue
+		}
+		update.SetAddress(addr, version)
+		if err := provider.Register(update, version); err != nil {
+			r.SetStatus(version, record.StateFailed, addr, err)
+			g.log.Error(
+				"gateway dns record update failed",
+				zap.String("username", c.Username),
+				zap.String("hostname", hostname),
+				zap.String("provider", c.Provider),
+				zap.Int("ip_version", version),
+				zap.String("address", addr),
+				zap.String("error", err.Error()),
+			)
+			return "911"
+		}
+		r.SetStatus(version, record.StateUpdated, addr, nil)
+		code = "good"
+		g.log.Info(
+			"gateway dns record updated",
+			zap.String("username", c.Username),
+			zap.String("hostname", hostname),
+			zap.String("provider", c.Provider),
+			zap.Int("ip_version", version),
+			zap.String("address", addr),
+		)
+	}
+	return code + " " + strings.Join(values, ",")
+}
+
+func runGatewayManager(s *Server, wg *sync.WaitGroup) {
+	defer wg.Done()
+	var fn = s.name + "-gateway-mgr"
+	s.log.Debug(
+		"starting sybsystem",
+		zap.String("subsystem", fn),
+		zap.String("app", s.name),
+		zap.String("listen", s.cfg.Gateway.Listen),
+	)
+
+	srv := &http.Server{
+		Addr:              s.cfg.Gateway.Listen,
+		Handler:           newGateway(s),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		var err error
+		if s.cfg.Gateway.TLSCertFile != "" {
+			err = srv.ListenAndServeTLS(s.cfg.Gateway.TLSCertFile, s.cfg.Gateway.TLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			serveErr <- err
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		s.log.Error(
+			"gateway server failed",
+			zap.String("subsystem", fn),
+			zap.String("app", s.name),
+			zap.String("error", err.Error()),
+		)
+		s.ctx.error <- fmt.Errorf("%s: gateway server failed: %s", s.name, err)
+		<-s.ctx.exitRoutine
+	case <-s.ctx.exitRoutine:
+		s.log.Debug(
+			"shutting down subsystem",
+			zap.String("subsystem", fn),
+			zap.String("app", s.name),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		srv.Shutdown(ctx)
+		cancel()
+	}
+
+	s.log.Debug(
+		"stopped subsystem",
+		zap.String("subsystem", fn),
+		zap.String("app", s.name),
+	)
+	s.ctx.error <- nil
+	return
+}
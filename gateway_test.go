@@ -0,0 +1,386 @@
+package dyndns
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/greenpau/dyndns/pkg/providers"
+	"github.com/greenpau/dyndns/pkg/record"
+	"go.uber.org/zap"
+)
+
+// testEngine is a RegistrationEngine recording registrations. The lookups
+// are supported when the addresses are set.
+type testEngine struct {
+	registrations []string
+	err           error
+	addrs         map[int][]string
+	outdated      [][]string
+}
+
+func (e *testEngine) Configure(*zap.Logger) error { return nil }
+func (e *testEngine) Validate() error             { return nil }
+func (e *testEngine) GetProvider() string         { return "test" }
+func (e *testEngine) Lookup(r *record.RegistrationRecord, version int) ([]string, error) {
+	if e.addrs == nil {
+		return nil, providers.ErrLookupNotSupported
+	}
+	return e.addrs[version], nil
+}
+func (e *testEngine) RegisterOutdated(r *record.RegistrationRecord, version int, current []string) error {
+	e.outdated = append(e.outdated, current)
+	return e.Register(r, version)
+}
+func (e *testEngine) Register(r *record.RegistrationRecord, version int) error {
+	if e.err != nil {
+		return e.err
+	}
+	addr, _ := r.GetAddress(version)
+	e.registrations = append(e.registrations, fmt.Sprintf("%s/%d/%s", r.Name, version, addr))
+	return nil
+}
+
+// testGatewayPolicy is the address policy of the gateway clients allowing
+// the documentation ranges, rejected by the default policy.
+var testGatewayPolicy = &record.AddressPolicy{
+	Allow:         []string{"198.51.100.0/24", "203.0.113.0/24", "2001:db8::/32"},
+	RejectSpecial: true,
+}
+
+func TestGateway(t *testing.T) {
+	engine := &testEngine{}
+	cfg := &Config{
+		Providers: map[string]*RegistrationProvider{
+			"default": {engine: engine},
+		},
+		Gateway: &GatewayConfig{
+			Clients: []*GatewayClient{
+				{Username: "router", Password: "secret", Hostnames: []string{"home.contoso.com", "nas.contoso.com."}, Policy: testGatewayPolicy},
+			},
+		},
+	}
+	if err := cfg.Gateway.validate(cfg); err != nil {
+		t.Fatalf("unexpected gateway validation error: %s", err)
+	}
+	g := &gateway{
+		cfg:         cfg.Gateway,
+		log:         zap.NewNop(),
+		getProvider: cfg.getProvider,
+		records:     make(map[string]*gatewayRecord),
+	}
+
+	testcases := []struct {
+		name          string
+		query         string
+		username      string
+		password      string
+		remoteAddr    string
+		engineErr     error
+		response      string
+		registrations []string
+	}{
+		{
+			name:          "good",
+			query:         "hostname=home.contoso.com&myip=203.0.113.10",
+			username:      "router",
+			password:      "secret",
+			response:      "good 203.0.113.10",
+			registrations: []string{"home.contoso.com/4/203.0.113.10"},
+		},
+		{
+			name:     "nochg",
+			query:    "hostname=home.contoso.com&myip=203.0.113.10",
+			username: "router",
+			password: "secret",
+			response: "nochg 203.0.113.10",
+		},
+		{
+			name:          "dual stack with multiple hostnames",
+			query:         "hostname=home.contoso.com,nas.contoso.com&myip=203.0.113.10,2001:db8::10",
+			username:      "router",
+			password:      "secret",
+			response:      "good 203.0.113.10,2001:db8::10\ngood 203.0.113.10,2001:db8::10",
+			registrations: []string{"home.contoso.com/6/2001:db8::10", "nas.contoso.com/4/203.0.113.10", "nas.contoso.com/6/2001:db8::10"},
+		},
+		{
+			name:          "address of the client",
+			query:         "hostname=home.contoso.com",
+			username:      "router",
+			password:      "secret",
+			remoteAddr:    "198.51.100.20:43210",
+			response:      "good 198.51.100.20",
+			registrations: []string{"home.contoso.com/4/198.51.100.20"},
+		},
+		{
+			name:     "badauth",
+			query:    "hostname=home.contoso.com&myip=203.0.113.10",
+			username: "router",
+			password: "invalid",
+			response: "badauth",
+		},
+		{
+			name:     "nohost",
+			query:    "hostname=www.contoso.com&myip=203.0.113.10",
+			username: "router",
+			password: "secret",
+			response: "nohost",
+		},
+		{
+			name:     "notfqdn",
+			query:    "hostname=home&myip=203.0.113.10",
+			username: "router",
+			password: "secret",
+			response: "notfqdn",
+		},
+		{
+			name:     "address rejected by policy",
+			query:    "hostname=home.contoso.com&myip=203.0.113.10,fd00::10",
+			username: "router",
+			password: "secret",
+			response: "dnserr",
+		},
+		{
+			name:      "provider failure",
+			query:     "hostname=home.contoso.com&myip=203.0.113.30",
+			username:  "router",
+			password:  "secret",
+			response:  "911",
+			engineErr: fmt.Errorf("provider is down"),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			engine.registrations = nil
+			engine.err = tc.engineErr
+			req := httptest.NewRequest(http.MethodGet, "/nic/update?"+tc.query, nil)
+			req.SetBasicAuth(tc.username, tc.password)
+			req.Header.Set("User-Agent", "Router/1.0 admin@contoso.com")
+			if tc.remoteAddr != "" {
+				req.RemoteAddr = tc.remoteAddr
+			}
+			w := httptest.NewRecorder()
+			g.ServeHTTP(w, req)
+			if resp := strings.TrimSpace(w.Body.String()); resp != tc.response {
+				t.Fatalf("unexpected response: %q (actual) vs. %q (expected)", resp, tc.response)
+			}
+			if strings.Join(engine.registrations, " ") != strings.Join(tc.registrations, " ") {
+				t.Fatalf("unexpected registrations: %v (actual) vs. %v (expected)", engine.registrations, tc.registrations)
+			}
+		})
+	}
+}
+
+// slowEngine is a RegistrationEngine blocking the registrations of the
+// provided hostname until released.
+type slowEngine struct {
+	testEngine
+	hostname string
+	started  chan struct{}
+	release  chan struct{}
+}
+
+func (e *slowEngine) Register(r *record.RegistrationRecord, version int) error {
+	if r.Name == e.hostname {
+		close(e.started)
+		<-e.release
+	}
+	return nil
+}
+
+func TestGatewaySlowProvider(t *testing.T) {
+	engine := &slowEngine{
+		hostname: "home.contoso.com",
+		started:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	cfg := &Config{
+		Providers: map[string]*RegistrationProvider{
+			"default": {engine: engine},
+		},
+		Gateway: &GatewayConfig{
+			Clients: []*GatewayClient{
+				{Username: "router", Password: "secret", Hostnames: []string{"home.contoso.com", "nas.contoso.com"}, Policy: testGatewayPolicy},
+			},
+		},
+	}
+	if err := cfg.Gateway.validate(cfg); err != nil {
+		t.Fatalf("unexpected gateway validation error: %s", err)
+	}
+	g := &gateway{
+		cfg:         cfg.Gateway,
+		log:         zap.NewNop(),
+		getProvider: cfg.getProvider,
+		records:     make(map[string]*gatewayRecord),
+	}
+
+	update := func(hostname string) string {
+		req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname="+hostname+"&myip=203.0.113.10", nil)
+		req.SetBasicAuth("router", "secret")
+		req.Header.Set("User-Agent", "Router/1.0 admin@contoso.com")
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, req)
+		return strings.TrimSpace(w.Body.String())
+	}
+
+	slow := make(chan string, 1)
+	go func() { slow <- update("home.contoso.com") }()
+	<-engine.started
+
+	done := make(chan string, 1)
+	go func() { done <- update("nas.contoso.com") }()
+	select {
+	case resp := <-done:
+		if resp != "good 203.0.113.10" {
+			t.Fatalf("unexpected response: %q", resp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("update blocked by slow registration of other hostname")
+	}
+
+	close(engine.release)
+	if resp := <-slow; resp != "good 203.0.113.10" {
+		t.Fatalf("unexpected response: %q", resp)
+	}
+}
+
+// countingEngine is a RegistrationEngine blocking the registrations until
+// released, and counting the registrations in progress.
+type countingEngine struct {
+	testEngine
+	mu        sync.Mutex
+	calls     int
+	active    int
+	maxActive int
+	release   chan struct{}
+}
+
+func (e *countingEngine) Register(r *record.RegistrationRecord, version int) error {
+	e.mu.Lock()
+	e.calls++
+	e.active++
+	if e.active > e.maxActive {
+		e.maxActive = e.active
+	}
+	e.mu.Unlock()
+	<-e.release
+	e.mu.Lock()
+	e.active--
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *countingEngine) getCalls() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls
+}
+
+func TestGatewayConcurrentUpdates(t *testing.T) {
+	engine := &countingEngine{release: make(chan struct{})}
+	cfg := &Config{
+		Providers: map[string]*RegistrationProvider{
+			"default": {engine: engine},
+		},
+		Gateway: &GatewayConfig{
+			Clients: []*GatewayClient{
+				{Username: "router", Password: "secret", Hostnames: []string{"home.contoso.com"}, Policy: testGatewayPolicy},
+			},
+		},
+	}
+	if err := cfg.Gateway.validate(cfg); err != nil {
+		t.Fatalf("unexpected gateway validation error: %s", err)
+	}
+	g := &gateway{
+		cfg:         cfg.Gateway,
+		log:         zap.NewNop(),
+		getProvider: cfg.getProvider,
+		records:     make(map[string]*gatewayRecord),
+	}
+
+	update := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname=home.contoso.com&myip=203.0.113.10", nil)
+		req.SetBasicAuth("router", "secret")
+		req.Header.Set("User-Agent", "Router/1.0 admin@contoso.com")
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, req)
+		return strings.TrimSpace(w.Body.String())
+	}
+
+	responses := make(chan string, 2)
+	go func() { responses <- update() }()
+	for engine.getCalls() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	go func() { responses <- update() }()
+	// The second update waits for the registration of the first one.
+	time.Sleep(100 * time.Millisecond)
+	if calls := engine.getCalls(); calls != 1 {
+		t.Fatalf("unexpected number of registrations in progress: %d", calls)
+	}
+	close(engine.release)
+
+	got := []string{<-responses, <-responses}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "good 203.0.113.10,nochg 203.0.113.10" {
+		t.Fatalf("unexpected responses: %v", got)
+	}
+	if engine.getCalls() != 1 || engine.maxActive != 1 {
+		t.Fatalf("unexpected registrations: %d calls, %d concurrent", engine.calls, engine.maxActive)
+	}
+}
+
+func TestGatewayDefaultPolicy(t *testing.T) {
+	engine := &testEngine{}
+	cfg := &Config{
+		Providers: map[string]*RegistrationProvider{
+			"default": {engine: engine},
+		},
+		Gateway: &GatewayConfig{
+			Clients: []*GatewayClient{
+				{Username: "router", Password: "secret", Hostnames: []string{"home.contoso.com"}},
+			},
+		},
+	}
+	if err := cfg.Gateway.validate(cfg); err != nil {
+		t.Fatalf("unexpected gateway validation error: %s", err)
+	}
+	g := &gateway{
+		cfg:         cfg.Gateway,
+		log:         zap.NewNop(),
+		getProvider: cfg.getProvider,
+		records:     make(map[string]*gatewayRecord),
+	}
+
+	testcases := []struct {
+		myip     string
+		response string
+	}{
+		{myip: "10.0.0.1", response: "dnserr"},
+		{myip: "100.64.0.1", response: "dnserr"},
+		{myip: "9.9.9.9,fd00::1", response: "dnserr"},
+		{myip: "9.9.9.9", response: "good 9.9.9.9"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.myip, func(t *testing.T) {
+			engine.registrations = nil
+			req := httptest.NewRequest(http.MethodGet, "/nic/update?hostname=home.contoso.com&myip="+tc.myip, nil)
+			req.SetBasicAuth("router", "secret")
+			req.Header.Set("User-Agent", "Router/1.0 admin@contoso.com")
+			w := httptest.NewRecorder()
+			g.ServeHTTP(w, req)
+			if resp := strings.TrimSpace(w.Body.String()); resp != tc.response {
+				t.Fatalf("unexpected response: %q (actual) vs. %q (expected)", resp, tc.response)
+			}
+			if tc.response == "dnserr" && len(engine.registrations) != 0 {
+				t.Fatalf("unexpected registrations: %v", engine.registrations)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Package netwatch notifies about the changes of the addresses of local
+// network interfaces.
+package netwatch
+
+import (
+	"net"
+)
+
+// Event is a change of an address of a network interface.
+type Event struct {
+	Interface string `json:"interface"`
+	Address   string `json:"address"`
+	Deleted   bool   `json:"deleted"`
+}
+
+// matchInterface returns true when the interface is in the list of the
+// watched interfaces, or when the list is empty.
+func matchInterface(name string, interfaces []string) bool {
+	if len(interfaces) == 0 {
+		return true
+	}
+	for _, s := range interfaces {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addressSet holds the addresses of the watched network interfaces. The
+// notifications not changing the addresses, e.g. the refreshes of the
+// lifetimes of IPv6 addresses on router advertisements, are dropped.
+type addressSet map[string]map[string]bool
+
+// newAddressSet returns the current addresses of the provided interfaces,
+// or of all interfaces when none are provided.
+func newAddressSet(interfaces []string) addressSet {
+	s := make(addressSet)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return s
+	}
+	for _, iface := range ifaces {
+		if !matchInterface(iface.Name, interfaces) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				s.update(Event{Interface: iface.Name, Address: ipnet.IP.String()})
+			}
+		}
+	}
+	return s
+}
+
+// update applies the provided event to the set. It returns true when the
+// set has changed, or when the event has no address.
+func (s addressSet) update(ev Event) bool {
+	if ev.Address == "" {
+		return true
+	}
+	addrs := s[ev.Interface]
+	if ev.Deleted {
+		if !addrs[ev.Address] {
+			return false
+		}
+		delete(addrs, ev.Address)
+		return true
+	}
+	if addrs[ev.Address] {
+		return false
+	}
+	if addrs == nil {
+		addrs = make(map[string]bool)
+		s[ev.Interface] = addrs
+	}
+	addrs[ev.Address] = true
+	return true
+}
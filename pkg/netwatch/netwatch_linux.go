@@ -0,0 +1,131 @@
+//go:build linux
+
+package netwatch
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The netlink multicast groups of address notifications, see rtnetlink.h.
+const (
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv6IfAddr = 0x100
+)
+
+// Watch subscribes to netlink RTM_NEWADDR and RTM_DELADDR notifications
+// and sends the changes of the addresses of the provided interfaces, or of
+// all interfaces when none are provided, to the returned channel. The
+// notifications of the addresses already known, or already deleted, are
+// dropped. The channel is closed after the done channel is closed, or when
+// receiving the notifications fails.
+func Watch(done <-chan struct{}, interfaces []string) (<-chan Event, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating netlink socket: %s", err)
+	}
+	sa := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpIPv4IfAddr | rtmgrpIPv6IfAddr,
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed binding netlink socket: %s", err)
+	}
+	// The receive timeout allows checking the done channel periodically.
+	tv := syscall.NsecToTimeval(int64(time.Second))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed setting netlink socket timeout: %s", err)
+	}
+
+	events := make(chan Event, 16)
+	go func() {
+		defer close(events)
+		defer syscall.Close(fd)
+		buf := make([]byte, syscall.Getpagesize()*4)
+		addrs := newAddressSet(interfaces)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK || err == syscall.EINTR {
+					continue
+				}
+				// The buffer overrun drops notifications. The watcher
+				// reports a change because an address might have changed.
+				if err == syscall.ENOBUFS {
+					addrs = newAddressSet(interfaces)
+					select {
+					case events <- Event{}:
+					case <-done:
+						return
+					}
+					continue
+				}
+				return
+			}
+			for _, ev := range parseMessages(buf[:n], interfaces) {
+				if !addrs.update(ev) {
+					continue
+				}
+				select {
+				case events <- ev:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// parseMessages returns the address changes found in netlink messages.
+func parseMessages(b []byte, interfaces []string) []Event {
+	events := []Event{}
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return events
+	}
+	for _, msg := range msgs {
+		if msg.Header.Type != syscall.RTM_NEWADDR && msg.Header.Type != syscall.RTM_DELADDR {
+			continue
+		}
+		if len(msg.Data) < syscall.SizeofIfAddrmsg {
+			continue
+		}
+		ifam := (*syscall.IfAddrmsg)(unsafe.Pointer(&msg.Data[0]))
+		var name string
+		if iface, err := net.InterfaceByIndex(int(ifam.Index)); err == nil {
+			name = iface.Name
+		}
+		if !matchInterface(name, interfaces) {
+			continue
+		}
+		ev := Event{
+			Interface: name,
+			Deleted:   msg.Header.Type == syscall.RTM_DELADDR,
+		}
+		attrs, err := syscall.ParseNetlinkRouteAttr(&msg)
+		if err != nil {
+			continue
+		}
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case syscall.IFA_LOCAL, syscall.IFA_ADDRESS:
+				if ev.Address == "" || attr.Attr.Type == syscall.IFA_LOCAL {
+					ev.Address = net.IP(attr.Value).String()
+				}
+			}
+		}
+		events = append(events, ev)
+	}
+	return events
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package netwatch
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// newAddressMessage returns a netlink address message.
+func newAddressMessage(msgType uint16, index int, ip net.IP) []byte {
+	family := syscall.AF_INET6
+	if ip4 := ip.To4(); ip4 != nil {
+		family = syscall.AF_INET
+		ip = ip4
+	}
+	attrLen := syscall.SizeofRtAttr + len(ip)
+	msgLen := syscall.NLMSG_HDRLEN + syscall.SizeofIfAddrmsg + attrLen
+	b := make([]byte, msgLen)
+	hdr := (*syscall.NlMsghdr)(unsafe.Pointer(&b[0]))
+	hdr.Len = uint32(msgLen)
+	hdr.Type = msgType
+	ifam := (*syscall.IfAddrmsg)(unsafe.Pointer(&b[syscall.NLMSG_HDRLEN]))
+	ifam.Family = uint8(family)
+	ifam.Index = uint32(index)
+	attr := b[syscall.NLMSG_HDRLEN+syscall.SizeofIfAddrmsg:]
+	binary.LittleEndian.PutUint16(attr[0:2], uint16(attrLen))
+	binary.LittleEndian.PutUint16(attr[2:4], syscall.IFA_ADDRESS)
+	copy(attr[syscall.SizeofRtAttr:], ip)
+	return b
+}
+
+func TestParseMessages(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("loopback interface not found: %s", err)
+	}
+
+	b := append(newAddressMessage(syscall.RTM_NEWADDR, lo.Index, net.ParseIP("203.0.113.10")),
+		newAddressMessage(syscall.RTM_DELADDR, lo.Index, net.ParseIP("2001:db8::10"))...)
+
+	events := parseMessages(b, nil)
+	if len(events) != 2 {
+		t.Fatalf("unexpected events: %v", events)
+	}
+	if events[0] != (Event{Interface: "lo", Address: "203.0.113.10"}) {
+		t.Fatalf("unexpected event: %v", events[0])
+	}
+	if events[1] != (Event{Interface: "lo", Address: "2001:db8::10", Deleted: true}) {
+		t.Fatalf("unexpected event: %v", events[1])
+	}
+
+	if events := parseMessages(b, []string{"eth0"}); len(events) != 0 {
+		t.Fatalf("unexpected events for other interface: %v", events)
+	}
+}
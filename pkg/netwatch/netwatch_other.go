@@ -0,0 +1,13 @@
+//go:build !linux
+
+package netwatch
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Watch is not supported on this platform. It always returns error.
+func Watch(done <-chan struct{}, interfaces []string) (<-chan Event, error) {
+	return nil, fmt.Errorf("netlink address notifications are not supported on %s", runtime.GOOS)
+}
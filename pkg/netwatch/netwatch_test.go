@@ -0,0 +1,28 @@
+package netwatch
+
+import (
+	"testing"
+)
+
+func TestAddressSetUpdate(t *testing.T) {
+	s := make(addressSet)
+	testcases := []struct {
+		name    string
+		event   Event
+		changed bool
+	}{
+		{name: "new address", event: Event{Interface: "eth0", Address: "2001:db8::10"}, changed: true},
+		{name: "refreshed address", event: Event{Interface: "eth0", Address: "2001:db8::10"}},
+		{name: "same address on other interface", event: Event{Interface: "eth1", Address: "2001:db8::10"}, changed: true},
+		{name: "deleted address", event: Event{Interface: "eth0", Address: "2001:db8::10", Deleted: true}, changed: true},
+		{name: "unknown deleted address", event: Event{Interface: "eth0", Address: "2001:db8::10", Deleted: true}},
+		{name: "dropped notifications", event: Event{}, changed: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if changed := s.update(tc.event); changed != tc.changed {
+				t.Fatalf("unexpected change: %t (actual) vs. %t (expected)", changed, tc.changed)
+			}
+		})
+	}
+}
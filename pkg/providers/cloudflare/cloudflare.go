@@ -0,0 +1,365 @@
+package cloudflare
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/providers"
+	"github.com/greenpau/dyndns/pkg/record"
+	"github.com/greenpau/dyndns/pkg/utils"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const defaultEndpoint = "https://api.cloudflare.com/client/v4"
+
+func init() {
+	providers.RegisterFactory("cloudflare", func() providers.Engine {
+		return &RegistrationProvider{}
+	})
+}
+
+// RegistrationProvider is a controller for updating DNS records hosted by
+// Cloudflare DNS service.
+type RegistrationProvider struct {
+	Provider string `json:"type" yaml:"type"`
+	ZoneID   string `json:"zone_id,omitempty" yaml:"zone_id,omitempty"`
+	Zone     string `json:"zone,omitempty" yaml:"zone,omitempty"`
+	APIToken string `json:"api_token" yaml:"api_token"`
+	Proxied  bool   `json:"proxied,omitempty" yaml:"proxied,omitempty"`
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	client   *http.Client
+	zone     *zoneCache
+	log      *zap.Logger
+}
+
+// zoneCache holds the id of the zone looked up by name.
+type zoneCache struct {
+	mu sync.Mutex
+	id string
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type apiResponse struct {
+	Success bool            `json:"success"`
+	Errors  []apiError      `json:"errors"`
+	Result  json.RawMessage `json:"result"`
+}
+
+type zone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type dnsRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     uint64 `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+}
+
+// MarshalJSON packs configuration of RegistrationProvider with the API
+// token masked.
+func (p RegistrationProvider) MarshalJSON() ([]byte, error) {
+	type config RegistrationProvider
+	c := config(p)
+	c.APIToken = utils.MaskSecret(c.APIToken, 4, 4)
+	return json.Marshal(c)
+}
+
+// Validate validates an instance of *RegistrationProvider.
+func (p *RegistrationProvider) Validate() error {
+	if p.ZoneID == "" && p.Zone == "" {
+		return fmt.Errorf("provider requires a zone name or zone id")
+	}
+	if p.APIToken == "" {
+		return fmt.Errorf("cloudflare api token not found")
+	}
+	if p.Provider != "cloudflare" {
+		return fmt.Errorf("provider mismatch: %s (config) vs. cloudflare (expected)", p.Provider)
+	}
+	return nil
+}
+
+// Configure configures an instance of *RegistrationProvider.
+func (p *RegistrationProvider) Configure(logger *zap.Logger) error {
+	p.log = logger
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if p.Endpoint == "" {
+		p.Endpoint = defaultEndpoint
+	}
+	p.Endpoint = strings.TrimRight(p.Endpoint, "/")
+	client, err := utils.NewBrowser()
+	if err != nil {
+		return err
+	}
+	p.client = client
+	p.zone = &zoneCache{}
+	p.log.Debug(
+		"found cloudflare credentials",
+		zap.String("api_token", utils.MaskSecret(p.APIToken, 4, 4)),
+		zap.String("endpoint", p.Endpoint),
+	)
+	return nil
+}
+
+// GetProvider returns the provider name associated with RegistrationProvider.
+func (p *RegistrationProvider) GetProvider() string {
+	return p.Provider
+}
+
+// Register registers a record with RegistrationProvider for the provided
+// IP version.
+func (p *RegistrationProvider) Register(r *record.RegistrationRecord, version int) error {
+	if r.Name == "" {
+		return fmt.Errorf("record name is empty")
+	}
+	rrType, err := record.GetRecordType(version)
+	if err != nil {
+		return err
+	}
+	addr, err := r.GetAddress(version)
+	if err != nil {
+		return err
+	}
+	if addr == "" {
+		return fmt.Errorf("record %s has no ip version %d address", r.Name, version)
+	}
+	name := strings.TrimSuffix(r.Name, ".")
+
+	p.log.Debug(
+		"received registration request",
+		zap.Any("record", r),
+		zap.String("type", rrType),
+		zap.Any("address", addr),
+	)
+
+	zoneID, err := p.getZoneID()
+	if err != nil {
+		return err
+	}
+
+	records, err := p.listRecords(zoneID, name, rrType)
+	if err != nil {
+		return err
+	}
+
+	ttl := r.TimeToLive
+	if p.Proxied {
+		// Proxied records always have automatic TTL.
+		ttl = 1
+	}
+	rec := &dnsRecord{
+		Type:    rrType,
+		Name:    name,
+		Content: addr,
+		TTL:     ttl,
+		Proxied: p.Proxied,
+	}
+
+	if len(records) == 0 {
+		if err := p.request(http.MethodPost, "/zones/"+zoneID+"/dns_records", rec, nil); err != nil {
+			return fmt.Errorf("create dns record request failed: %s", err)
+		}
+		p.log.Info(
+			"dns record created",
+			zap.String("zone_id", zoneID),
+			zap.String("name", name),
+			zap.String("type", rrType),
+			zap.String("address", addr),
+		)
+		return nil
+	}
+
+	// The record already holding the address is kept, and the other
+	// records with the same name and type are deleted.
+	current := records[0]
+	for _, rec := range records {
+		if rec.Content == addr && rec.Proxied == p.Proxied {
+			current = rec
+			break
+		}
+	}
+	if current.Content == addr && current.Proxied == p.Proxied && len(records) == 1 {
+		p.log.Debug(
+			"dns record is up to date",
+			zap.String("zone_id", zoneID),
+			zap.String("name", name),
+			zap.String("type", rrType),
+			zap.String("address", addr),
+		)
+		return nil
+	}
+
+	outdated := []string{}
+	for _, rec := range records {
+		outdated = append(outdated, rec.Content)
+	}
+	p.log.Info(
+		"dns record is outdated",
+		zap.String("zone_id", zoneID),
+		zap.String("name", name),
+		zap.String("type", rrType),
+		zap.Strings("outdated_addresses", outdated),
+		zap.String("address", addr),
+	)
+
+	if current.Content != addr || current.Proxied != p.Proxied {
+		if err := p.request(http.MethodPut, "/zones/"+zoneID+"/dns_records/"+current.ID, rec, nil); err != nil {
+			return fmt.Errorf("update dns record request failed: %s", err)
+		}
+		p.log.Info(
+			"dns record updated",
+			zap.String("zone_id", zoneID),
+			zap.String("record_id", current.ID),
+			zap.String("name", name),
+			zap.String("type", rrType),
+			zap.String("address", addr),
+		)
+	}
+
+	for _, extra := range records {
+		if extra == current {
+			continue
+		}
+		if err := p.request(http.MethodDelete, "/zones/"+zoneID+"/dns_records/"+extra.ID, nil, nil); err != nil {
+			return fmt.Errorf("delete dns record request failed: %s", err)
+		}
+		p.log.Info(
+			"dns record deleted",
+			zap.String("zone_id", zoneID),
+			zap.String("record_id", extra.ID),
+			zap.String("name", name),
+			zap.String("type", rrType),
+			zap.String("address", extra.Content),
+		)
+	}
+	return nil
+}
+
+// Lookup returns the addresses of the provided IP version of a record
+// registered with RegistrationProvider. The records with the proxied setting
+// differing from the configured one are skipped, so that they are updated.
+func (p *RegistrationProvider) Lookup(r *record.RegistrationRecord, version int) ([]string, error) {
+	rrType, err := record.GetRecordType(version)
+	if err != nil {
+		return nil, err
+	}
+	zoneID, err := p.getZoneID()
+	if err != nil {
+		return nil, err
+	}
+	records, err := p.listRecords(zoneID, strings.TrimSuffix(r.Name, "."), rrType)
+	if err != nil {
+		return nil, err
+	}
+	addrs := []string{}
+	for _, rec := range records {
+		if rec.Proxied != p.Proxied {
+			continue
+		}
+		addrs = append(addrs, rec.Content)
+	}
+	return addrs, nil
+}
+
+// getZoneID returns the configured zone id, or looks the zone up by name.
+// The id of the zone found is cached.
+func (p *RegistrationProvider) getZoneID() (string, error) {
+	if p.ZoneID != "" {
+		return p.ZoneID, nil
+	}
+	p.zone.mu.Lock()
+	defer p.zone.mu.Unlock()
+	if p.zone.id != "" {
+		return p.zone.id, nil
+	}
+	zones := []zone{}
+	q := url.Values{}
+	q.Set("name", strings.TrimSuffix(p.Zone, "."))
+	if err := p.request(http.MethodGet, "/zones?"+q.Encode(), nil, &zones); err != nil {
+		return "", fmt.Errorf("zone lookup request failed: %s", err)
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("zone %s not found", p.Zone)
+	}
+	p.log.Debug(
+		"dns zone found",
+		zap.String("zone_id", zones[0].ID),
+		zap.String("zone", zones[0].Name),
+	)
+	p.zone.id = zones[0].ID
+	return p.zone.id, nil
+}
+
+// listRecords returns DNS records with the provided name and type.
+func (p *RegistrationProvider) listRecords(zoneID, name, rrType string) ([]*dnsRecord, error) {
+	records := []*dnsRecord{}
+	q := url.Values{}
+	q.Set("name", name)
+	q.Set("type", rrType)
+	if err := p.request(http.MethodGet, "/zones/"+zoneID+"/dns_records?"+q.Encode(), nil, &records); err != nil {
+		return nil, fmt.Errorf("list dns records request failed: %s", err)
+	}
+	return records, nil
+}
+
+// request sends a request to the Cloudflare API and decodes the result of
+// the response into the provided value.
+func (p *RegistrationProvider) request(method, path string, body, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, p.Endpoint+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.APIToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %s", err)
+	}
+	apiResp := &apiResponse{}
+	if err := json.Unmarshal(respBody, apiResp); err != nil {
+		return fmt.Errorf("error parsing response, status code %d: %s", resp.StatusCode, err)
+	}
+	if !apiResp.Success {
+		msgs := []string{}
+		for _, e := range apiResp.Errors {
+			msgs = append(msgs, fmt.Sprintf("%d: %s", e.Code, e.Message))
+		}
+		return fmt.Errorf("api error, status code %d: %s", resp.StatusCode, strings.Join(msgs, ", "))
+	}
+	if result != nil {
+		if err := json.Unmarshal(apiResp.Result, result); err != nil {
+			return fmt.Errorf("error parsing response result: %s", err)
+		}
+	}
+	return nil
+}
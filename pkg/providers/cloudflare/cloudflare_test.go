@@ -0,0 +1,342 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/greenpau/dyndns/pkg/record"
+	"go.uber.org/zap"
+)
+
+// testAPI is a stand-in for the Cloudflare API holding a single zone.
+type testAPI struct {
+	mu      sync.Mutex
+	token   string
+	zoneID  string
+	zone    string
+	records map[string]*dnsRecord
+	calls   []string
+}
+
+func (api *testAPI) reply(w http.ResponseWriter, code int, result interface{}) {
+	resp := map[string]interface{}{"success": code == http.StatusOK, "errors": []apiError{}, "result": result}
+	if code != http.StatusOK {
+		resp["errors"] = []apiError{{Code: 10000, Message: http.StatusText(code)}}
+	}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (api *testAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.calls = append(api.calls, r.Method+" "+r.URL.Path)
+	if r.Header.Get("Authorization") != "Bearer "+api.token {
+		api.reply(w, http.StatusForbidden, nil)
+		return
+	}
+	recordsPath := "/zones/" + api.zoneID + "/dns_records"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/zones":
+		zones := []zone{}
+		if r.URL.Query().Get("name") == api.zone {
+			zones = append(zones, zone{ID: api.zoneID, Name: api.zone})
+		}
+		api.reply(w, http.StatusOK, zones)
+	case r.Method == http.MethodGet && r.URL.Path == recordsPath:
+		records := []*dnsRecord{}
+		for _, rec := range api.records {
+			if rec.Name == r.URL.Query().Get("name") && rec.Type == r.URL.Query().Get("type") {
+				records = append(records, rec)
+			}
+		}
+		api.reply(w, http.StatusOK, records)
+	case r.Method == http.MethodPost && r.URL.Path == recordsPath:
+		rec := &dnsRecord{}
+		json.NewDecoder(r.Body).Decode(rec)
+		rec.ID = rec.Type + "-" + rec.Name
+		api.records[rec.ID] = rec
+		api.reply(w, http.StatusOK, rec)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, recordsPath+"/"):
+		id := strings.TrimPrefix(r.URL.Path, recordsPath+"/")
+		if _, exists := api.records[id]; !exists {
+			api.reply(w, http.StatusNotFound, nil)
+			return
+		}
+		delete(api.records, id)
+		api.reply(w, http.StatusOK, map[string]string{"id": id})
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, recordsPath+"/"):
+		id := strings.TrimPrefix(r.URL.Path, recordsPath+"/")
+		if _, exists := api.records[id]; !exists {
+			api.reply(w, http.StatusNotFound, nil)
+			return
+		}
+		rec := &dnsRecord{}
+		json.NewDecoder(r.Body).Decode(rec)
+		rec.ID = id
+		api.records[id] = rec
+		api.reply(w, http.StatusOK, rec)
+	default:
+		api.reply(w, http.StatusNotFound, nil)
+	}
+}
+
+func (api *testAPI) getCalls() []string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	calls := api.calls
+	api.calls = nil
+	return calls
+}
+
+func TestRegister(t *testing.T) {
+	api := &testAPI{
+		token:   "secret-token-value",
+		zoneID:  "023e105f4ecef8ad9ca31a8372d0c353",
+		zone:    "contoso.com",
+		records: make(map[string]*dnsRecord),
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	p := &RegistrationProvider{
+		Provider: "cloudflare",
+		Zone:     "contoso.com",
+		APIToken: api.token,
+		Endpoint: srv.URL,
+	}
+	if err := p.Configure(zap.NewNop()); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+
+	r := &record.RegistrationRecord{Name: "app.contoso.com", Type: "ALL", TimeToLive: 60}
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name    string
+		version int
+		addr    string
+		calls   []string
+	}{
+		{
+			name:    "create a record",
+			version: 4,
+			addr:    "203.0.113.10",
+			calls:   []string{"GET /zones", "GET /zones/" + api.zoneID + "/dns_records", "POST /zones/" + api.zoneID + "/dns_records"},
+		},
+		{
+			name:    "record is up to date",
+			version: 4,
+			addr:    "203.0.113.10",
+			calls:   []string{"GET /zones/" + api.zoneID + "/dns_records"},
+		},
+		{
+			name:    "update a record",
+			version: 4,
+			addr:    "203.0.113.20",
+			calls:   []string{"GET /zones/" + api.zoneID + "/dns_records", "PUT /zones/" + api.zoneID + "/dns_records/A-app.contoso.com"},
+		},
+		{
+			name:    "create aaaa record",
+			version: 6,
+			addr:    "2001:db8::10",
+			calls:   []string{"GET /zones/" + api.zoneID + "/dns_records", "POST /zones/" + api.zoneID + "/dns_records"},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := r.SetAddress(tc.addr, tc.version); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Register(r, tc.version); err != nil {
+				t.Fatalf("unexpected registration error: %s", err)
+			}
+			calls := api.getCalls()
+			if strings.Join(calls, "\n") != strings.Join(tc.calls, "\n") {
+				t.Fatalf("unexpected api calls:\n%v (actual)\n%v (expected)", calls, tc.calls)
+			}
+			rrType, _ := record.GetRecordType(tc.version)
+			rec, exists := api.records[rrType+"-app.contoso.com"]
+			if !exists {
+				t.Fatalf("record not found")
+			}
+			if rec.Content != tc.addr || rec.TTL != 60 {
+				t.Fatalf("unexpected record: %+v", rec)
+			}
+		})
+	}
+}
+
+func TestRegisterProxied(t *testing.T) {
+	api := &testAPI{
+		token:   "secret-token-value",
+		zoneID:  "023e105f4ecef8ad9ca31a8372d0c353",
+		records: make(map[string]*dnsRecord),
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	p := &RegistrationProvider{
+		Provider: "cloudflare",
+		ZoneID:   api.zoneID,
+		APIToken: api.token,
+		Proxied:  true,
+		Endpoint: srv.URL,
+	}
+	if err := p.Configure(zap.NewNop()); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+	r := &record.RegistrationRecord{Name: "app.contoso.com.", TimeToLive: 60}
+	r.Validate()
+	r.SetAddress("203.0.113.10", 4)
+	if err := p.Register(r, 4); err != nil {
+		t.Fatalf("unexpected registration error: %s", err)
+	}
+	rec := api.records["A-app.contoso.com"]
+	if rec == nil || !rec.Proxied || rec.TTL != 1 {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+
+	p.APIToken = "invalid-token"
+	r.SetAddress("203.0.113.20", 4)
+	if err := p.Register(r, 4); err == nil {
+		t.Fatalf("expected error with invalid api token")
+	}
+}
+
+func TestRegisterDuplicateRecords(t *testing.T) {
+	testcases := []struct {
+		name    string
+		records []*dnsRecord
+		addr    string
+		calls   []string
+	}{
+		{
+			name: "one of records is up to date",
+			records: []*dnsRecord{
+				{ID: "A-1", Type: "A", Name: "app.contoso.com", Content: "198.51.100.1", TTL: 60},
+				{ID: "A-2", Type: "A", Name: "app.contoso.com", Content: "203.0.113.10", TTL: 60},
+			},
+			addr: "203.0.113.10",
+			calls: []string{
+				"GET /zones/023e105f4ecef8ad9ca31a8372d0c353/dns_records",
+				"DELETE /zones/023e105f4ecef8ad9ca31a8372d0c353/dns_records/A-1",
+			},
+		},
+		{
+			name: "records are outdated",
+			records: []*dnsRecord{
+				{ID: "A-1", Type: "A", Name: "app.contoso.com", Content: "198.51.100.1", TTL: 60},
+				{ID: "A-2", Type: "A", Name: "app.contoso.com", Content: "198.51.100.2", TTL: 60},
+			},
+			addr: "203.0.113.10",
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			api := &testAPI{
+				token:   "secret-token-value",
+				zoneID:  "023e105f4ecef8ad9ca31a8372d0c353",
+				records: make(map[string]*dnsRecord),
+			}
+			for _, rec := range tc.records {
+				api.records[rec.ID] = rec
+			}
+			srv := httptest.NewServer(api)
+			defer srv.Close()
+
+			p := &RegistrationProvider{
+				Provider: "cloudflare",
+				ZoneID:   api.zoneID,
+				APIToken: api.token,
+				Endpoint: srv.URL,
+			}
+			if err := p.Configure(zap.NewNop()); err != nil {
+				t.Fatalf("unexpected configuration error: %s", err)
+			}
+			r := &record.RegistrationRecord{Name: "app.contoso.com", TimeToLive: 60}
+			r.Validate()
+			r.SetAddress(tc.addr, 4)
+			if err := p.Register(r, 4); err != nil {
+				t.Fatalf("unexpected registration error: %s", err)
+			}
+			// The order of outdated records is not defined.
+			if tc.calls != nil {
+				calls := api.getCalls()
+				if strings.Join(calls, "\n") != strings.Join(tc.calls, "\n") {
+					t.Fatalf("unexpected api calls:\n%v (actual)\n%v (expected)", calls, tc.calls)
+				}
+			}
+
+			// The single record with the address remains.
+			addrs, err := p.Lookup(r, 4)
+			if err != nil {
+				t.Fatalf("unexpected lookup error: %s", err)
+			}
+			if len(addrs) != 1 || addrs[0] != tc.addr {
+				t.Fatalf("unexpected addresses: %v", addrs)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	api := &testAPI{
+		token:  "secret-token-value",
+		zoneID: "023e105f4ecef8ad9ca31a8372d0c353",
+		records: map[string]*dnsRecord{
+			"A-app.contoso.com":    {ID: "A-app.contoso.com", Type: "A", Name: "app.contoso.com", Content: "203.0.113.10"},
+			"AAAA-app.contoso.com": {ID: "AAAA-app.contoso.com", Type: "AAAA", Name: "app.contoso.com", Content: "2001:db8::10", Proxied: true},
+		},
+	}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	p := &RegistrationProvider{
+		Provider: "cloudflare",
+		ZoneID:   api.zoneID,
+		APIToken: api.token,
+		Endpoint: srv.URL,
+	}
+	if err := p.Configure(zap.NewNop()); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+	r := &record.RegistrationRecord{Name: "app.contoso.com", Type: "ALL"}
+	r.Validate()
+
+	addrs, err := p.Lookup(r, 4)
+	if err != nil {
+		t.Fatalf("unexpected lookup error: %s", err)
+	}
+	if len(addrs) != 1 || addrs[0] != "203.0.113.10" {
+		t.Fatalf("unexpected addresses: %v", addrs)
+	}
+
+	// The proxied record differs from the configuration, and must be
+	// updated.
+	addrs, err = p.Lookup(r, 6)
+	if err != nil {
+		t.Fatalf("unexpected lookup error: %s", err)
+	}
+	if len(addrs) != 0 {
+		t.Fatalf("unexpected addresses: %v", addrs)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	p := &RegistrationProvider{Provider: "cloudflare", ZoneID: "foo", APIToken: "secret-token-value"}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret-token-value") {
+		t.Fatalf("api token is not masked: %s", b)
+	}
+}
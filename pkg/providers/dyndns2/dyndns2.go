@@ -0,0 +1,311 @@
+package dyndns2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/providers"
+	"github.com/greenpau/dyndns/pkg/record"
+	"github.com/greenpau/dyndns/pkg/utils"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEndpoint  = "https://dynupdate.no-ip.com/nic/update"
+	defaultUserAgent = "greenpau-dyndns/1.0 github.com/greenpau/dyndns"
+	// serverErrorBackoff is the time the protocol requires clients to wait
+	// after a 911 or dnserr response.
+	serverErrorBackoff = 30 * time.Minute
+)
+
+// The errors returned for the dyndns2 response codes.
+var (
+	ErrBadAuth     = errors.New("badauth: invalid username or password")
+	ErrNotDonator  = errors.New("!donator: option available only to credited users")
+	ErrNotFQDN     = errors.New("notfqdn: hostname is not a fully-qualified domain name")
+	ErrNoHost      = errors.New("nohost: hostname does not exist in this user account")
+	ErrNumHost     = errors.New("numhost: too many hosts specified in an update")
+	ErrAbuse       = errors.New("abuse: hostname is blocked for update abuse")
+	ErrBadAgent    = errors.New("badagent: user agent was not sent or http method is not permitted")
+	ErrDNSError    = errors.New("dnserr: dns error encountered by the server")
+	ErrServerError = errors.New("911: problem or scheduled maintenance on the server")
+)
+
+func init() {
+	providers.RegisterFactory("dyndns2", func() providers.Engine {
+		return &RegistrationProvider{}
+	})
+}
+
+// RegistrationProvider is a controller for updating DNS records with
+// the dyndns2 protocol, e.g. No-IP or DynDNS.
+type RegistrationProvider struct {
+	Provider  string `json:"type" yaml:"type"`
+	Endpoint  string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	Username  string `json:"username" yaml:"username"`
+	Password  string `json:"password" yaml:"password"`
+	UserAgent string `json:"user_agent,omitempty" yaml:"user_agent,omitempty"`
+	client    *http.Client
+	log       *zap.Logger
+	now       func() time.Time
+	suspended *suspension
+}
+
+// suspension holds the updates suspended in response to the errors
+// returned by the server.
+type suspension struct {
+	mu sync.Mutex
+	// blocked holds the error suspending all updates until the
+	// configuration is fixed.
+	blocked error
+	// blockedHosts holds the errors suspending updates of hostnames
+	// until the configuration is fixed.
+	blockedHosts map[string]error
+	// retryAfter is the time before which updates are suspended after
+	// a server error.
+	retryAfter time.Time
+	retryErr   error
+}
+
+// MarshalJSON packs configuration of RegistrationProvider with the
+// password masked.
+func (p RegistrationProvider) MarshalJSON() ([]byte, error) {
+	type config RegistrationProvider
+	c := config(p)
+	c.Password = utils.MaskSecret(c.Password, 2, 2)
+	return json.Marshal(c)
+}
+
+// Validate validates an instance of *RegistrationProvider.
+func (p *RegistrationProvider) Validate() error {
+	if p.Username == "" {
+		return fmt.Errorf("provider requires a username")
+	}
+	if p.Password == "" {
+		return fmt.Errorf("provider requires a password")
+	}
+	if p.Endpoint != "" {
+		u, err := url.Parse(p.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid endpoint %s", p.Endpoint)
+		}
+	}
+	if p.Provider != "dyndns2" {
+		return fmt.Errorf("provider mismatch: %s (config) vs. dyndns2 (expected)", p.Provider)
+	}
+	return nil
+}
+
+// Configure configures an instance of *RegistrationProvider.
+func (p *RegistrationProvider) Configure(logger *zap.Logger) error {
+	p.log = logger
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if p.Endpoint == "" {
+		p.Endpoint = defaultEndpoint
+	}
+	if p.UserAgent == "" {
+		p.UserAgent = defaultUserAgent
+	}
+	if p.now == nil {
+		p.now = time.Now
+	}
+	p.suspended = &suspension{blockedHosts: make(map[string]error)}
+	client, err := utils.NewBrowser()
+	if err != nil {
+		return err
+	}
+	p.client = client
+	p.log.Debug(
+		"configured dyndns2 endpoint",
+		zap.String("endpoint", p.Endpoint),
+		zap.String("username", p.Username),
+		zap.String("password", utils.MaskSecret(p.Password, 2, 2)),
+	)
+	return nil
+}
+
+// GetProvider returns the provider name associated with RegistrationProvider.
+func (p *RegistrationProvider) GetProvider() string {
+	return p.Provider
+}
+
+// Lookup is not supported by the dyndns2 protocol.
+func (p *RegistrationProvider) Lookup(r *record.RegistrationRecord, version int) ([]string, error) {
+	return nil, providers.ErrLookupNotSupported
+}
+
+// Register registers a record with RegistrationProvider for the provided
+// IP version. Following the protocol, updates are suspended after the
+// responses indicating a configuration problem or abuse, and for
+// 30 minutes after the responses indicating a server error.
+func (p *RegistrationProvider) Register(r *record.RegistrationRecord, version int) error {
+	if r.Name == "" {
+		return fmt.Errorf("record name is empty")
+	}
+	addr, err := r.GetAddress(version)
+	if err != nil {
+		return err
+	}
+	if addr == "" {
+		return fmt.Errorf("record %s has no ip version %d address", r.Name, version)
+	}
+	hostname := strings.TrimSuffix(r.Name, ".")
+
+	if err := p.checkSuspended(hostname); err != nil {
+		return err
+	}
+
+	p.log.Debug(
+		"received registration request",
+		zap.Any("record", r),
+		zap.Int("ip_version", version),
+		zap.Any("address", addr),
+	)
+
+	q := url.Values{}
+	q.Set("hostname", hostname)
+	q.Set("myip", addr)
+	reqURL := p.Endpoint
+	if strings.Contains(reqURL, "?") {
+		reqURL += "&" + q.Encode()
+	} else {
+		reqURL += "?" + q.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("error creating http get: %s", err)
+	}
+	req.SetBasicAuth(p.Username, p.Password)
+	req.Header.Set("User-Agent", p.UserAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request error: %s", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %s", err)
+	}
+	responseBody := strings.TrimSpace(string(body))
+
+	code := responseBody
+	if i := strings.IndexAny(code, " \r\n"); i > 0 {
+		code = code[:i]
+	}
+
+	switch code {
+	case "good":
+		p.log.Info(
+			"dns record updated",
+			zap.String("hostname", hostname),
+			zap.Int("ip_version", version),
+			zap.String("address", addr),
+			zap.String("response", responseBody),
+		)
+		return nil
+	case "nochg":
+		p.log.Debug(
+			"dns record is up to date",
+			zap.String("hostname", hostname),
+			zap.Int("ip_version", version),
+			zap.String("address", addr),
+			zap.String("response", responseBody),
+		)
+		return nil
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && code == "" {
+		code = "badauth"
+	}
+
+	respErr := getResponseError(code)
+	if respErr == nil {
+		return fmt.Errorf("unexpected response, status code %d: %q", resp.StatusCode, responseBody)
+	}
+	p.suspend(hostname, respErr)
+	return respErr
+}
+
+// getResponseError returns the error associated with the response code.
+func getResponseError(code string) error {
+	switch code {
+	case "badauth":
+		return ErrBadAuth
+	case "!donator":
+		return ErrNotDonator
+	case "notfqdn":
+		return ErrNotFQDN
+	case "nohost":
+		return ErrNoHost
+	case "numhost":
+		return ErrNumHost
+	case "abuse":
+		return ErrAbuse
+	case "badagent":
+		return ErrBadAgent
+	case "dnserr":
+		return ErrDNSError
+	case "911":
+		return ErrServerError
+	}
+	return nil
+}
+
+// suspend suspends further updates in response to the provided error.
+func (p *RegistrationProvider) suspend(hostname string, err error) {
+	ss := p.suspended
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	switch err {
+	case ErrDNSError, ErrServerError:
+		ss.retryAfter = p.now().Add(serverErrorBackoff)
+		ss.retryErr = err
+		p.log.Warn(
+			"suspended updates after server error",
+			zap.String("hostname", hostname),
+			zap.Time("retry_after", ss.retryAfter),
+			zap.String("error", err.Error()),
+		)
+	case ErrNotFQDN, ErrNoHost, ErrNumHost, ErrAbuse:
+		ss.blockedHosts[hostname] = err
+		p.log.Error(
+			"suspended hostname updates until configuration is fixed",
+			zap.String("hostname", hostname),
+			zap.String("error", err.Error()),
+		)
+	default:
+		ss.blocked = err
+		p.log.Error(
+			"suspended all updates until configuration is fixed",
+			zap.String("hostname", hostname),
+			zap.String("error", err.Error()),
+		)
+	}
+}
+
+// checkSuspended returns error when updates of the provided hostname are
+// suspended.
+func (p *RegistrationProvider) checkSuspended(hostname string) error {
+	ss := p.suspended
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.blocked != nil {
+		return fmt.Errorf("updates are suspended until configuration is fixed: %w", ss.blocked)
+	}
+	if err, exists := ss.blockedHosts[hostname]; exists {
+		return fmt.Errorf("updates of %s are suspended until configuration is fixed: %w", hostname, err)
+	}
+	if p.now().Before(ss.retryAfter) {
+		return fmt.Errorf("updates are suspended until %s: %w", ss.retryAfter.Format(time.RFC3339), ss.retryErr)
+	}
+	return nil
+}
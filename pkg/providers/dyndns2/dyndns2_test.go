@@ -0,0 +1,174 @@
+package dyndns2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/greenpau/dyndns/pkg/record"
+	"go.uber.org/zap"
+)
+
+// errUnexpected matches any error.
+var errUnexpected = errors.New("unexpected response")
+
+func TestRegister(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	var response string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "jsmith" || pass != "secret" {
+			fmt.Fprint(w, "badauth")
+			return
+		}
+		if r.URL.Path != "/nic/update" || r.URL.Query().Get("hostname") != "app.contoso.com" || r.UserAgent() == "" {
+			fmt.Fprint(w, "badagent")
+			return
+		}
+		fmt.Fprint(w, strings.ReplaceAll(response, "%s", r.URL.Query().Get("myip")))
+	}))
+	defer srv.Close()
+
+	testcases := []struct {
+		name     string
+		password string
+		// responses are the responses of the server to the consecutive
+		// registration attempts.
+		responses []string
+		// errs are the expected errors of the consecutive registration
+		// attempts, nil for success.
+		errs []error
+		// requests is the expected number of requests to the server.
+		requests int
+		// elapsed is the time passing between registration attempts.
+		elapsed time.Duration
+	}{
+		{name: "good", password: "secret", responses: []string{"good %s", "nochg %s"}, errs: []error{nil, nil}, requests: 2},
+		{name: "badauth", password: "invalid", responses: []string{"", ""}, errs: []error{ErrBadAuth, ErrBadAuth}, requests: 1},
+		{name: "abuse", password: "secret", responses: []string{"abuse", "good %s"}, errs: []error{ErrAbuse, ErrAbuse}, requests: 1},
+		{name: "nohost", password: "secret", responses: []string{"nohost", "good %s"}, errs: []error{ErrNoHost, ErrNoHost}, requests: 1},
+		{name: "911 before backoff", password: "secret", responses: []string{"911", "good %s"}, errs: []error{ErrServerError, ErrServerError}, requests: 1, elapsed: 10 * time.Minute},
+		{name: "911 after backoff", password: "secret", responses: []string{"911", "good %s"}, errs: []error{ErrServerError, nil}, requests: 2, elapsed: 31 * time.Minute},
+		{name: "dnserr", password: "secret", responses: []string{"dnserr"}, errs: []error{ErrDNSError}, requests: 1},
+		{name: "unexpected response", password: "secret", responses: []string{"foo"}, errs: []error{errUnexpected}, requests: 1},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			mu.Lock()
+			requests = 0
+			mu.Unlock()
+
+			now := time.Now()
+			p := &RegistrationProvider{
+				Provider: "dyndns2",
+				Endpoint: srv.URL + "/nic/update",
+				Username: "jsmith",
+				Password: tc.password,
+				now:      func() time.Time { return now },
+			}
+			if err := p.Configure(zap.NewNop()); err != nil {
+				t.Fatalf("unexpected configuration error: %s", err)
+			}
+			r := &record.RegistrationRecord{Name: "app.contoso.com"}
+			r.Validate()
+			r.SetAddress("203.0.113.10", 4)
+
+			for i, resp := range tc.responses {
+				mu.Lock()
+				response = resp
+				mu.Unlock()
+				err := p.Register(r, 4)
+				switch {
+				case tc.errs[i] == nil && err != nil:
+					t.Fatalf("attempt %d: unexpected error: %s", i, err)
+				case tc.errs[i] != nil && err == nil:
+					t.Fatalf("attempt %d: expected error %s, got success", i, tc.errs[i])
+				case tc.errs[i] != nil && tc.errs[i] != errUnexpected && !errors.Is(err, tc.errs[i]):
+					t.Fatalf("attempt %d: unexpected error: %s (actual) vs. %s (expected)", i, err, tc.errs[i])
+				}
+				now = now.Add(tc.elapsed)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if requests != tc.requests {
+				t.Fatalf("unexpected number of requests: %d (actual) vs. %d (expected)", requests, tc.requests)
+			}
+		})
+	}
+}
+
+func TestRegisterAbuse(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hostname := r.URL.Query().Get("hostname")
+		requests[hostname]++
+		if hostname == "app.contoso.com" {
+			fmt.Fprint(w, "abuse")
+			return
+		}
+		fmt.Fprintf(w, "good %s", r.URL.Query().Get("myip"))
+	}))
+	defer srv.Close()
+
+	p := &RegistrationProvider{
+		Provider: "dyndns2",
+		Endpoint: srv.URL + "/nic/update",
+		Username: "jsmith",
+		Password: "secret",
+	}
+	if err := p.Configure(zap.NewNop()); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+
+	blocked := &record.RegistrationRecord{Name: "app.contoso.com"}
+	blocked.Validate()
+	blocked.SetAddress("203.0.113.10", 4)
+	other := &record.RegistrationRecord{Name: "www.contoso.com"}
+	other.Validate()
+	other.SetAddress("203.0.113.10", 4)
+
+	for i := 0; i < 2; i++ {
+		if err := p.Register(blocked, 4); !errors.Is(err, ErrAbuse) {
+			t.Fatalf("attempt %d: unexpected error: %v (actual) vs. %s (expected)", i, err, ErrAbuse)
+		}
+		if err := p.Register(other, 4); err != nil {
+			t.Fatalf("attempt %d: unexpected error for other hostname: %s", i, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests["app.contoso.com"] != 1 || requests["www.contoso.com"] != 2 {
+		t.Fatalf("unexpected number of requests: %v", requests)
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	p := RegistrationProvider{Provider: "dyndns2", Username: "jsmith", Password: "secret-password"}
+	for _, v := range []interface{}{p, &p} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "secret-password") {
+			t.Fatalf("password is not masked: %s", b)
+		}
+		if strings.Contains(string(b), "endpoint") {
+			t.Fatalf("empty endpoint is packed: %s", b)
+		}
+	}
+}
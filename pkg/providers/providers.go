@@ -0,0 +1,65 @@
+// Package providers holds the registry of DNS provider engines. Provider
+// packages register a factory for their type name in init, and the
+// configuration decoder creates engines by the type name found in the
+// provider configuration.
+package providers
+
+import (
+	"errors"
+	"github.com/greenpau/dyndns/pkg/record"
+	"github.com/greenpau/dyndns/pkg/registry"
+	"go.uber.org/zap"
+)
+
+// ErrLookupNotSupported is returned by the engines unable to look up the
+// records they registered, e.g. dyndns2 services.
+var ErrLookupNotSupported = errors.New("dns record lookup is not supported")
+
+// Engine is the interface implemented by DNS provider engines. Lookup
+// returns the addresses of the provided IP version of a record as known to
+// the provider, or ErrLookupNotSupported.
+type Engine interface {
+	Configure(*zap.Logger) error
+	Validate() error
+	GetProvider() string
+	Register(*record.RegistrationRecord, int) error
+	Lookup(*record.RegistrationRecord, int) ([]string, error)
+}
+
+// OutdatedRegistrar is implemented by the engines looking a record up before
+// registering it. RegisterOutdated registers a record whose addresses, as
+// returned by Lookup, differ from the address of the record, without
+// looking the record up again.
+type OutdatedRegistrar interface {
+	RegisterOutdated(*record.RegistrationRecord, int, []string) error
+}
+
+// Stopper is implemented by the engines whose registrations may block for
+// a long time, e.g. waiting for a change to propagate. Stop interrupts the
+// registrations in progress on shutdown.
+type Stopper interface {
+	Stop()
+}
+
+// Factory returns a new, unconfigured instance of an Engine.
+type Factory func() Engine
+
+var factories = registry.New[Engine]("providers", "provider", "dns provider")
+
+// RegisterFactory makes a provider engine available under the provided
+// type name. It panics if the name is empty, the factory is nil, or the
+// name is already registered.
+func RegisterFactory(name string, factory Factory) {
+	factories.Register(name, factory)
+}
+
+// New returns a new instance of the engine registered under the provided
+// type name.
+func New(name string) (Engine, error) {
+	return factories.New(name)
+}
+
+// Names returns sorted type names of the registered provider engines.
+func Names() []string {
+	return factories.Names()
+}
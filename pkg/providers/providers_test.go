@@ -0,0 +1,43 @@
+package providers
+
+import (
+	"github.com/greenpau/dyndns/pkg/record"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+)
+
+type testEngine struct{}
+
+func (e *testEngine) Configure(*zap.Logger) error                    { return nil }
+func (e *testEngine) Validate() error                                { return nil }
+func (e *testEngine) GetProvider() string                            { return "registry_test" }
+func (e *testEngine) Register(*record.RegistrationRecord, int) error { return nil }
+func (e *testEngine) Lookup(*record.RegistrationRecord, int) ([]string, error) {
+	return nil, ErrLookupNotSupported
+}
+
+func TestRegistry(t *testing.T) {
+	RegisterFactory("registry_test", func() Engine { return &testEngine{} })
+
+	engine, err := New("registry_test")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if engine.GetProvider() != "registry_test" {
+		t.Fatalf("unexpected provider: %s", engine.GetProvider())
+	}
+
+	if _, err := New("foo"); err == nil {
+		t.Fatalf("expected error for unknown provider type")
+	} else if !strings.Contains(err.Error(), "registry_test") {
+		t.Fatalf("expected available providers in error: %s", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic on duplicate registration")
+		}
+	}()
+	RegisterFactory("registry_test", func() Engine { return &testEngine{} })
+}
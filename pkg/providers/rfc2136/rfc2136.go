@@ -0,0 +1,295 @@
+package rfc2136
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/providers"
+	"github.com/greenpau/dyndns/pkg/record"
+	"github.com/greenpau/dyndns/pkg/utils"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTSIGAlgorithm = "hmac-sha256"
+	defaultTimeout       = 10
+)
+
+func init() {
+	providers.RegisterFactory("rfc2136", func() providers.Engine {
+		return &RegistrationProvider{}
+	})
+}
+
+// RegistrationProvider is a controller for updating DNS records with
+// RFC 2136 dynamic update messages, optionally signed with TSIG, sent
+// to the primary server of a zone.
+type RegistrationProvider struct {
+	Provider      string `json:"type" yaml:"type"`
+	Server        string `json:"server" yaml:"server"`
+	Zone          string `json:"zone" yaml:"zone"`
+	Transport     string `json:"transport,omitempty" yaml:"transport,omitempty"`
+	TSIGKeyName   string `json:"tsig_key_name,omitempty" yaml:"tsig_key_name,omitempty"`
+	TSIGSecret    string `json:"tsig_secret,omitempty" yaml:"tsig_secret,omitempty"`
+	TSIGAlgorithm string `json:"tsig_algorithm,omitempty" yaml:"tsig_algorithm,omitempty"`
+	Timeout       uint64 `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	log           *zap.Logger
+}
+
+// MarshalJSON packs configuration of RegistrationProvider with the TSIG
+// secret masked.
+func (p RegistrationProvider) MarshalJSON() ([]byte, error) {
+	type config RegistrationProvider
+	c := config(p)
+	c.TSIGSecret = utils.MaskSecret(c.TSIGSecret, 4, 4)
+	return json.Marshal(c)
+}
+
+// Validate validates an instance of *RegistrationProvider.
+func (p *RegistrationProvider) Validate() error {
+	if p.Server == "" {
+		return fmt.Errorf("provider requires a primary server")
+	}
+	if p.Zone == "" {
+		return fmt.Errorf("provider requires a zone")
+	}
+	switch p.Transport {
+	case "", "udp", "tcp":
+	default:
+		return fmt.Errorf("unsupported transport %s, must be one of the following: udp, tcp", p.Transport)
+	}
+	if (p.TSIGKeyName == "") != (p.TSIGSecret == "") {
+		return fmt.Errorf("tsig key name and tsig secret must be provided together")
+	}
+	if p.TSIGAlgorithm != "" {
+		if _, err := getTSIGAlgorithm(p.TSIGAlgorithm); err != nil {
+			return err
+		}
+	}
+	if p.Provider != "rfc2136" {
+		return fmt.Errorf("provider mismatch: %s (config) vs. rfc2136 (expected)", p.Provider)
+	}
+	return nil
+}
+
+func getTSIGAlgorithm(s string) (string, error) {
+	algorithm := dns.Fqdn(strings.ToLower(s))
+	switch algorithm {
+	case "hmac-md5.", dns.HmacMD5:
+		// Older servers may support the legacy algorithm only.
+		return dns.HmacMD5, nil
+	case dns.HmacSHA1, dns.HmacSHA224, dns.HmacSHA256, dns.HmacSHA384, dns.HmacSHA512:
+		return algorithm, nil
+	}
+	return "", fmt.Errorf("unsupported tsig algorithm %s", s)
+}
+
+// hmacMD5Key is the base64 secret of a TSIG key signing the messages with
+// HMAC-MD5, no longer supported by the dns package.
+type hmacMD5Key string
+
+// Generate returns the HMAC-MD5 signature of the provided message.
+func (key hmacMD5Key) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	if dns.CanonicalName(t.Algorithm) != dns.HmacMD5 {
+		return nil, dns.ErrKeyAlg
+	}
+	secret, err := base64.StdEncoding.DecodeString(string(key))
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(md5.New, secret)
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+// Verify verifies the HMAC-MD5 signature of the provided message.
+func (key hmacMD5Key) Verify(msg []byte, t *dns.TSIG) error {
+	b, err := key.Generate(msg, t)
+	if err != nil {
+		return err
+	}
+	mac, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(b, mac) {
+		return dns.ErrSig
+	}
+	return nil
+}
+
+// Configure configures an instance of *RegistrationProvider.
+func (p *RegistrationProvider) Configure(logger *zap.Logger) error {
+	p.log = logger
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if p.Transport == "" {
+		p.Transport = "udp"
+	}
+	if p.Timeout == 0 {
+		p.Timeout = defaultTimeout
+	}
+	if _, _, err := net.SplitHostPort(p.Server); err != nil {
+		p.Server = net.JoinHostPort(p.Server, "53")
+	}
+	if p.TSIGKeyName != "" && p.TSIGAlgorithm == "" {
+		p.TSIGAlgorithm = defaultTSIGAlgorithm
+	}
+	if algorithm, _ := getTSIGAlgorithm(p.TSIGAlgorithm); algorithm == dns.HmacMD5 {
+		p.log.Warn(
+			"tsig algorithm hmac-md5 is deprecated, consider hmac-sha256",
+			zap.String("server", p.Server),
+			zap.String("tsig_key_name", p.TSIGKeyName),
+		)
+	}
+	p.log.Debug(
+		"configured dynamic update server",
+		zap.String("server", p.Server),
+		zap.String("zone", p.Zone),
+		zap.String("transport", p.Transport),
+		zap.String("tsig_key_name", p.TSIGKeyName),
+		zap.String("tsig_algorithm", p.TSIGAlgorithm),
+		zap.String("tsig_secret", utils.MaskSecret(p.TSIGSecret, 4, 4)),
+	)
+	return nil
+}
+
+// GetProvider returns the provider name associated with RegistrationProvider.
+func (p *RegistrationProvider) GetProvider() string {
+	return p.Provider
+}
+
+// Register registers a record with RegistrationProvider for the provided
+// IP version. The update deletes the existing rrset of the record and adds
+// the new one in a single message.
+func (p *RegistrationProvider) Register(r *record.RegistrationRecord, version int) error {
+	if r.Name == "" {
+		return fmt.Errorf("record name is empty")
+	}
+	rrType, err := record.GetRecordType(version)
+	if err != nil {
+		return err
+	}
+	addr, err := r.GetAddress(version)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return fmt.Errorf("record %s has no valid ip version %d address: %q", r.Name, version, addr)
+	}
+
+	zone := dns.Fqdn(p.Zone)
+	fqdn := dns.Fqdn(r.Name)
+	if !dns.IsSubDomain(zone, fqdn) {
+		return fmt.Errorf("record %s is outside of zone %s", fqdn, zone)
+	}
+
+	p.log.Debug(
+		"received registration request",
+		zap.Any("record", r),
+		zap.String("type", rrType),
+		zap.Any("address", addr),
+	)
+
+	hdr := dns.RR_Header{Name: fqdn, Class: dns.ClassINET, Ttl: uint32(r.TimeToLive)}
+	var rr dns.RR
+	if version == 4 {
+		hdr.Rrtype = dns.TypeA
+		rr = &dns.A{Hdr: hdr, A: ip}
+	} else {
+		hdr.Rrtype = dns.TypeAAAA
+		rr = &dns.AAAA{Hdr: hdr, AAAA: ip}
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(zone)
+	m.RemoveRRset([]dns.RR{rr})
+	m.Insert([]dns.RR{rr})
+
+	client := p.newClient()
+	if p.TSIGKeyName != "" {
+		algorithm, err := getTSIGAlgorithm(p.TSIGAlgorithm)
+		if err != nil {
+			return err
+		}
+		m.SetTsig(dns.Fqdn(p.TSIGKeyName), algorithm, 300, time.Now().Unix())
+	}
+
+	resp, _, err := client.Exchange(m, p.Server)
+	if err != nil {
+		return fmt.Errorf("dynamic update request to %s failed: %s", p.Server, err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("dynamic update request to %s failed: %s", p.Server, dns.RcodeToString[resp.Rcode])
+	}
+
+	p.log.Info(
+		"dns resource record updated",
+		zap.String("server", p.Server),
+		zap.String("zone", zone),
+		zap.String("fqdn", fqdn),
+		zap.String("type", rrType),
+		zap.String("address", addr),
+	)
+	return nil
+}
+
+// Lookup returns the addresses of the provided IP version of a record
+// served by the primary server.
+func (p *RegistrationProvider) Lookup(r *record.RegistrationRecord, version int) ([]string, error) {
+	rrType, err := record.GetRecordType(version)
+	if err != nil {
+		return nil, err
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(r.Name), dns.StringToType[rrType])
+	m.RecursionDesired = false
+	if p.TSIGKeyName != "" {
+		algorithm, err := getTSIGAlgorithm(p.TSIGAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		m.SetTsig(dns.Fqdn(p.TSIGKeyName), algorithm, 300, time.Now().Unix())
+	}
+	resp, _, err := p.newClient().Exchange(m, p.Server)
+	if err != nil {
+		return nil, fmt.Errorf("query to %s failed: %s", p.Server, err)
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("query to %s failed: %s", p.Server, dns.RcodeToString[resp.Rcode])
+	}
+	addrs := []string{}
+	for _, rr := range resp.Answer {
+		switch t := rr.(type) {
+		case *dns.A:
+			addrs = append(addrs, t.A.String())
+		case *dns.AAAA:
+			addrs = append(addrs, t.AAAA.String())
+		}
+	}
+	return addrs, nil
+}
+
+// newClient returns DNS client for the primary server.
+func (p *RegistrationProvider) newClient() *dns.Client {
+	client := &dns.Client{
+		Net:     p.Transport,
+		Timeout: time.Duration(p.Timeout) * time.Second,
+	}
+	if p.TSIGKeyName != "" {
+		client.TsigSecret = map[string]string{dns.Fqdn(p.TSIGKeyName): p.TSIGSecret}
+		if algorithm, _ := getTSIGAlgorithm(p.TSIGAlgorithm); algorithm == dns.HmacMD5 {
+			client.TsigProvider = hmacMD5Key(p.TSIGSecret)
+		}
+	}
+	return client
+}
@@ -0,0 +1,260 @@
+package rfc2136
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/greenpau/dyndns/pkg/record"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+const (
+	testKeyName = "dyndns."
+	testSecret  = "c2VjcmV0LXRzaWcta2V5LXZhbHVlLWZvci10ZXN0cw=="
+)
+
+// testServer is a stand-in for the primary server of a zone. The queries
+// are answered with the preconfigured records.
+type testServer struct {
+	mu      sync.Mutex
+	updates []*dns.Msg
+	answers []dns.RR
+}
+
+func (s *testServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	switch {
+	case req.IsTsig() == nil || w.TsigStatus() != nil:
+		resp.Rcode = dns.RcodeNotAuth
+	case req.Opcode == dns.OpcodeQuery:
+		resp.Authoritative = true
+		for _, rr := range s.answers {
+			if rr.Header().Name == req.Question[0].Name && rr.Header().Rrtype == req.Question[0].Qtype {
+				resp.Answer = append(resp.Answer, rr)
+			}
+		}
+	case req.Opcode != dns.OpcodeUpdate:
+		resp.Rcode = dns.RcodeNotImplemented
+	default:
+		s.mu.Lock()
+		s.updates = append(s.updates, req)
+		s.mu.Unlock()
+	}
+	if tsig := req.IsTsig(); tsig != nil && w.TsigStatus() == nil {
+		resp.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+	}
+	w.WriteMsg(resp)
+}
+
+// startTestServer starts the stand-in. The provider, if any, replaces the
+// TSIG implementation of the dns package.
+func startTestServer(t *testing.T, handler dns.Handler, provider dns.TsigProvider) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{
+		PacketConn:        pc,
+		Handler:           handler,
+		TsigSecret:        map[string]string{testKeyName: testSecret},
+		TsigProvider:      provider,
+		NotifyStartedFunc: func() { close(started) },
+		// The default accept function rejects UPDATE messages.
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func TestRegister(t *testing.T) {
+	handler := &testServer{}
+	addr := startTestServer(t, handler, nil)
+
+	testcases := []struct {
+		name      string
+		secret    string
+		record    string
+		version   int
+		address   string
+		shouldErr bool
+	}{
+		{name: "update a record", secret: testSecret, record: "app.contoso.com", version: 4, address: "203.0.113.10"},
+		{name: "update aaaa record", secret: testSecret, record: "app.contoso.com", version: 6, address: "2001:db8::10"},
+		{name: "invalid tsig secret", secret: "aW52YWxpZC1zZWNyZXQ=", record: "app.contoso.com", version: 4, address: "203.0.113.10", shouldErr: true},
+		{name: "record outside of zone", secret: testSecret, record: "app.example.com", version: 4, address: "203.0.113.10", shouldErr: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler.mu.Lock()
+			handler.updates = nil
+			handler.mu.Unlock()
+
+			p := &RegistrationProvider{
+				Provider:    "rfc2136",
+				Server:      addr,
+				Zone:        "contoso.com",
+				TSIGKeyName: "dyndns",
+				TSIGSecret:  tc.secret,
+				Timeout:     2,
+			}
+			if err := p.Configure(zap.NewNop()); err != nil {
+				t.Fatalf("unexpected configuration error: %s", err)
+			}
+			r := &record.RegistrationRecord{Name: tc.record, Type: "ALL", TimeToLive: 60}
+			r.Validate()
+			r.SetAddress(tc.address, tc.version)
+
+			err := p.Register(r, tc.version)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected error, got success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected registration error: %s", err)
+			}
+
+			handler.mu.Lock()
+			defer handler.mu.Unlock()
+			if len(handler.updates) != 1 {
+				t.Fatalf("unexpected number of updates: %d", len(handler.updates))
+			}
+			m := handler.updates[0]
+			if m.Question[0].Name != "contoso.com." || m.Question[0].Qtype != dns.TypeSOA {
+				t.Fatalf("unexpected zone section: %v", m.Question)
+			}
+			if len(m.Ns) != 2 {
+				t.Fatalf("unexpected update section: %v", m.Ns)
+			}
+			rrType, _ := record.GetRecordType(tc.version)
+			// The first RR deletes the rrset, the second one adds new rrset.
+			if m.Ns[0].Header().Class != dns.ClassANY || dns.TypeToString[m.Ns[0].Header().Rrtype] != rrType {
+				t.Fatalf("unexpected delete rrset: %v", m.Ns[0])
+			}
+			var got string
+			switch rr := m.Ns[1].(type) {
+			case *dns.A:
+				got = rr.A.String()
+			case *dns.AAAA:
+				got = rr.AAAA.String()
+			}
+			if got != tc.address || m.Ns[1].Header().Ttl != 60 || m.Ns[1].Header().Name != "app.contoso.com." {
+				t.Fatalf("unexpected add rrset: %v", m.Ns[1])
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	a, _ := dns.NewRR("app.contoso.com. 60 IN A 203.0.113.10")
+	aaaa1, _ := dns.NewRR("app.contoso.com. 60 IN AAAA 2001:db8::10")
+	aaaa2, _ := dns.NewRR("app.contoso.com. 60 IN AAAA 2001:db8::11")
+	handler := &testServer{answers: []dns.RR{a, aaaa1, aaaa2}}
+	addr := startTestServer(t, handler, nil)
+
+	p := &RegistrationProvider{
+		Provider:    "rfc2136",
+		Server:      addr,
+		Zone:        "contoso.com",
+		TSIGKeyName: "dyndns",
+		TSIGSecret:  testSecret,
+		Timeout:     2,
+	}
+	if err := p.Configure(zap.NewNop()); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+
+	testcases := []struct {
+		name    string
+		record  string
+		version int
+		want    []string
+	}{
+		{name: "a record", record: "app.contoso.com", version: 4, want: []string{"203.0.113.10"}},
+		{name: "aaaa records", record: "app.contoso.com", version: 6, want: []string{"2001:db8::10", "2001:db8::11"}},
+		{name: "record not found", record: "www.contoso.com", version: 4, want: []string{}},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &record.RegistrationRecord{Name: tc.record, Type: "ALL"}
+			r.Validate()
+			addrs, err := p.Lookup(r, tc.version)
+			if err != nil {
+				t.Fatalf("unexpected lookup error: %s", err)
+			}
+			if strings.Join(addrs, ",") != strings.Join(tc.want, ",") {
+				t.Fatalf("unexpected addresses: %v (actual) vs. %v (expected)", addrs, tc.want)
+			}
+		})
+	}
+}
+
+func TestRegisterHmacMD5(t *testing.T) {
+	handler := &testServer{}
+	addr := startTestServer(t, handler, hmacMD5Key(testSecret))
+
+	p := &RegistrationProvider{
+		Provider:      "rfc2136",
+		Server:        addr,
+		Zone:          "contoso.com",
+		TSIGKeyName:   "dyndns",
+		TSIGSecret:    testSecret,
+		TSIGAlgorithm: "hmac-md5",
+		Timeout:       2,
+	}
+	if err := p.Configure(zap.NewNop()); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+	r := &record.RegistrationRecord{Name: "app.contoso.com", Type: "ALL", TimeToLive: 60}
+	r.Validate()
+	r.SetAddress("203.0.113.10", 4)
+	if err := p.Register(r, 4); err != nil {
+		t.Fatalf("unexpected registration error: %s", err)
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if len(handler.updates) != 1 {
+		t.Fatalf("unexpected number of updates: %d", len(handler.updates))
+	}
+	if tsig := handler.updates[0].IsTsig(); tsig == nil || tsig.Algorithm != dns.HmacMD5 {
+		t.Fatalf("unexpected tsig: %v", tsig)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testcases := []struct {
+		name      string
+		provider  *RegistrationProvider
+		shouldErr bool
+	}{
+		{name: "valid", provider: &RegistrationProvider{Provider: "rfc2136", Server: "ns1.contoso.com", Zone: "contoso.com", TSIGKeyName: "dyndns", TSIGSecret: testSecret, TSIGAlgorithm: "hmac-sha512"}},
+		{name: "legacy algorithm", provider: &RegistrationProvider{Provider: "rfc2136", Server: "ns1.contoso.com", Zone: "contoso.com", TSIGKeyName: "dyndns", TSIGSecret: testSecret, TSIGAlgorithm: "hmac-md5"}},
+		{name: "without tsig", provider: &RegistrationProvider{Provider: "rfc2136", Server: "ns1.contoso.com", Zone: "contoso.com"}},
+		{name: "missing server", provider: &RegistrationProvider{Provider: "rfc2136", Zone: "contoso.com"}, shouldErr: true},
+		{name: "missing zone", provider: &RegistrationProvider{Provider: "rfc2136", Server: "ns1.contoso.com"}, shouldErr: true},
+		{name: "missing tsig secret", provider: &RegistrationProvider{Provider: "rfc2136", Server: "ns1.contoso.com", Zone: "contoso.com", TSIGKeyName: "dyndns"}, shouldErr: true},
+		{name: "unsupported algorithm", provider: &RegistrationProvider{Provider: "rfc2136", Server: "ns1.contoso.com", Zone: "contoso.com", TSIGKeyName: "dyndns", TSIGSecret: testSecret, TSIGAlgorithm: "hmac-md4"}, shouldErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.provider.Validate()
+			if tc.shouldErr && err == nil {
+				t.Fatalf("expected error, got success")
+			}
+			if !tc.shouldErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
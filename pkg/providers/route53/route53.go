@@ -8,32 +8,77 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/route53"
 	"github.com/go-ini/ini"
+	"github.com/greenpau/dyndns/pkg/providers"
 	"github.com/greenpau/dyndns/pkg/record"
 	"github.com/greenpau/dyndns/pkg/utils"
+	"github.com/miekg/dns"
 	"go.uber.org/zap"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	// defaultSyncTimeout is the default time, in seconds, to wait for
+	// a change to propagate to all Route 53 DNS servers.
+	defaultSyncTimeout = 300
+	// defaultSyncInterval is the interval between the change status checks.
+	defaultSyncInterval = 5 * time.Second
+)
+
+func init() {
+	providers.RegisterFactory("route53", func() providers.Engine {
+		return &RegistrationProvider{}
+	})
+}
+
 // RegistrationProvider is a controller for updating DNS records hosted byo
-// AWS Route 53 service.
+// AWS Route 53 service. With wait_for_sync enabled, the registration waits
+// until the change propagates to all Route 53 DNS servers, up to the sync
+// timeout. The endpoint overrides the address of Route 53 API.
+//
+// Without zone_id, the hosted zone of a record is the zone with the longest
+// name the record belongs to. The public zones are considered, unless
+// vpc_id is configured. Then, the private zones associated with the VPC are
+// considered instead.
 type RegistrationProvider struct {
 	Provider        string `json:"type" yaml:"type"`
-	ZoneID          string `json:"zone_id" yaml:"zone_id"`
+	ZoneID          string `json:"zone_id,omitempty" yaml:"zone_id,omitempty"`
+	VPCID           string `json:"vpc_id,omitempty" yaml:"vpc_id,omitempty"`
+	VPCRegion       string `json:"vpc_region,omitempty" yaml:"vpc_region,omitempty"`
 	Credentials     string `json:"credentials" yaml:"credentials"`
 	ProfileName     string `json:"profile_name" yaml:"profile_name"`
+	WaitForSync     bool   `json:"wait_for_sync,omitempty" yaml:"wait_for_sync,omitempty"`
+	SyncTimeout     uint64 `json:"sync_timeout,omitempty" yaml:"sync_timeout,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
 	accessKeyID     string
 	secretAccessKey string
 	region          string
+	syncInterval    time.Duration
+	pageSize        string
+	mu              sync.Mutex
+	zones           map[string]*hostedZone
+	stop            chan struct{}
+	stopOnce        sync.Once
 	log             *zap.Logger
 }
 
+// hostedZone is the hosted zone of a record.
+type hostedZone struct {
+	id   string
+	name string
+}
+
 // Validate validates an instance op *RegistrationProvider.
 func (p *RegistrationProvider) Validate() error {
-	if p.ZoneID == "" {
-		return fmt.Errorf("provider requires a hosted zone id")
+	if p.ZoneID != "" && p.VPCID != "" {
+		return fmt.Errorf("zone id and vpc id are mutually exclusive")
+	}
+	if p.VPCRegion != "" && p.VPCID == "" {
+		return fmt.Errorf("vpc region requires vpc id")
 	}
 	if p.Credentials == "" {
 		return fmt.Errorf("aws credentials not found")
@@ -93,6 +138,17 @@ func (p *RegistrationProvider) Configure(logger *zap.Logger) error {
 	if p.ProfileName == "" {
 		p.ProfileName = "default"
 	}
+	if p.SyncTimeout == 0 {
+		p.SyncTimeout = defaultSyncTimeout
+	}
+	if p.syncInterval == 0 {
+		p.syncInterval = defaultSyncInterval
+	}
+	if p.pageSize == "" {
+		p.pageSize = "100"
+	}
+	p.zones = make(map[string]*hostedZone)
+	p.stop = make(chan struct{})
 	if err := p.Validate(); err != nil {
 		return err
 	}
@@ -113,149 +169,102 @@ func (p *RegistrationProvider) GetProvider() string {
 	return p.Provider
 }
 
-// Register registers a record with RegistrationProvider.
-func (p *RegistrationProvider) Register(r *record.RegistrationRecord) error {
+// Stop interrupts the registrations waiting for their changes to be in
+// sync.
+func (p *RegistrationProvider) Stop() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
+
+// Register registers a record with RegistrationProvider for the provided
+// IP version.
+func (p *RegistrationProvider) Register(r *record.RegistrationRecord, version int) error {
+	return p.register(r, version, nil, false)
+}
+
+// RegisterOutdated registers a record with RegistrationProvider for the
+// provided IP version. The provided values, returned by Lookup, are known to
+// differ from the address of the record, and the record is not listed again.
+func (p *RegistrationProvider) RegisterOutdated(r *record.RegistrationRecord, version int, values []string) error {
+	return p.register(r, version, values, true)
+}
+
+// register registers a record. Unless the current values of the record are
+// provided, the record is looked up first, and left unchanged when it is up
+// to date.
+func (p *RegistrationProvider) register(r *record.RegistrationRecord, version int, values []string, looked bool) error {
 	if r.Name == "" {
 		return fmt.Errorf("record name is empty")
 	}
-	nameParts := strings.SplitN(r.Name, ".", 2)
-	hostname := nameParts[0]
-	expDomain := nameParts[1]
+	rrType, err := record.GetRecordType(version)
+	if err != nil {
+		return err
+	}
+	hostname := strings.SplitN(r.Name, ".", 2)[0]
 	fqdn := r.Name
 	if !strings.HasSuffix(fqdn, ".") {
 		fqdn += "."
 	}
 
-	ip4, err := r.GetAddress(4)
+	addr, err := r.GetAddress(version)
 	if err != nil {
 		return err
 	}
+	if addr == "" {
+		return fmt.Errorf("record %s has no ip version %d address", r.Name, version)
+	}
 
 	p.log.Debug(
 		"received registration request",
 		zap.Any("record", r),
-		zap.Any("address", ip4),
+		zap.String("type", rrType),
+		zap.Any("address", addr),
 	)
 
-	// Acquire AWS Session
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String(p.region),
-		Credentials: credentials.NewStaticCredentials(p.accessKeyID, p.secretAccessKey, ""),
-	})
+	svc, err := p.newService()
 	if err != nil {
-		return fmt.Errorf("failed create aws session: %s", err)
+		return err
 	}
 
-	// Connect to AWS Service
-	svc := route53.New(sess)
-
-	// Get information about Route 53 Zone
-	hostedZoneRequest := &route53.GetHostedZoneInput{
-		Id: aws.String(p.ZoneID),
-	}
-	hostedZoneResponse, err := svc.GetHostedZone(hostedZoneRequest)
+	zone, err := p.getHostedZone(svc, fqdn)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case route53.ErrCodeNoSuchHostedZone:
-				return fmt.Errorf("zone id %s not found: %s", p.ZoneID, aerr.Error())
-			case route53.ErrCodeInvalidInput:
-				return fmt.Errorf("invalid get hosted zone request in zone id %s: %s", p.ZoneID, aerr.Error())
-			default:
-				return fmt.Errorf("get hosted zone request failed: %s", aerr.Error())
-			}
-		}
-		return fmt.Errorf("get hosted zone request failed: %s", err.Error())
-	}
-
-	if hostedZoneResponse.HostedZone == nil {
-		return fmt.Errorf("get hosted zone request returned nil")
-	}
-
-	domain := strings.TrimRight(*hostedZoneResponse.HostedZone.Name, ".")
-	if expDomain != domain {
-		return fmt.Errorf("hosted zone mismatch: %s (expected) vs. %s (actual)", expDomain, domain)
-	}
-
-	var reverseDomain string
-	domainParts := strings.Split(domain, ".")
-	for i := len(domainParts) - 1; i >= 0; i-- {
-		reverseDomain += "." + domainParts[i]
+		return err
 	}
-	// reverseDomain += "."
-
-	p.log.Debug(
-		"dns zone found",
-		zap.String("zone_id", p.ZoneID),
-		zap.String("domain", domain),
-		// zap.Any("record_prefix", reverseDomain),
-	)
 
 	// Get information about existing records
-	recordUpdated := false
-	recordSetRequest := &route53.ListResourceRecordSetsInput{}
-	recordSetRequest.SetHostedZoneId(p.ZoneID)
-	recordSetRequest.SetMaxItems("100")
-	if err := recordSetRequest.Validate(); err != nil {
-		return fmt.Errorf("list resource record sets request validation error: %s", err)
-	}
-
-	recordSetResponse, err := svc.ListResourceRecordSets(recordSetRequest)
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case route53.ErrCodeNoSuchHostedZone:
-				return fmt.Errorf("zone id %s not found: %s", p.ZoneID, aerr.Error())
-			case route53.ErrCodeInvalidInput:
-				return fmt.Errorf("invalid list resource record sets request in zone id %s: %s", p.ZoneID, aerr.Error())
-			default:
-				return fmt.Errorf("list resource record sets request failed: %s", aerr.Error())
-			}
-		}
-		return fmt.Errorf("list resource record sets request failed: %s", err.Error())
-	}
-
-	var recordCurrentValue string
-	for _, rrset := range recordSetResponse.ResourceRecordSets {
-		if string(*rrset.Name) != fqdn {
-			continue
-		}
-		if len(rrset.ResourceRecords) != 1 {
-			continue
-		}
-		rr := rrset.ResourceRecords[0]
-		if string(*rr.Value) != ip4 {
-			recordCurrentValue = string(*rr.Value)
-			continue
+	if !looked {
+		values, err = p.listRecordValues(svc, zone.id, fqdn, rrType)
+		if err != nil {
+			return err
 		}
-		recordUpdated = true
 	}
 
-	if recordUpdated {
+	if len(values) == 1 && values[0] == addr {
 		p.log.Debug(
 			"dns resource record set is up to date",
-			zap.String("zone_id", p.ZoneID),
+			zap.String("zone_id", zone.id),
 			zap.String("hostname", hostname),
 			zap.String("fqdn", fqdn),
-			zap.String("ip4", ip4),
+			zap.String("type", rrType),
+			zap.String("address", addr),
 		)
 		return nil
 	}
 
 	p.log.Info(
 		"dns resource record set is outdated",
-		zap.String("zone_id", p.ZoneID),
+		zap.String("zone_id", zone.id),
 		zap.String("hostname", hostname),
 		zap.String("fqdn", fqdn),
-		zap.String("outdated_ip4", recordCurrentValue),
-		zap.String("ip4", ip4),
+		zap.String("type", rrType),
+		zap.Strings("outdated_addresses", values),
+		zap.String("address", addr),
 	)
 
 	rr := &route53.ResourceRecord{}
-	rr.SetValue(ip4)
+	rr.SetValue(addr)
 	rrSet := &route53.ResourceRecordSet{}
 	rrSet.SetName(fqdn)
-	rrSet.SetType("A")
+	rrSet.SetType(rrType)
 	rrSet.SetTTL(int64(r.TimeToLive))
 	// rrSet.SetWeight(0)
 	rrSet.SetResourceRecords([]*route53.ResourceRecord{rr})
@@ -279,21 +288,23 @@ func (p *RegistrationProvider) Register(r *record.RegistrationRecord) error {
 	}
 
 	rrBatchChangeRequest := &route53.ChangeResourceRecordSetsInput{}
-	rrBatchChangeRequest.SetHostedZoneId(p.ZoneID)
+	rrBatchChangeRequest.SetHostedZoneId(zone.id)
 	rrBatchChangeRequest.SetChangeBatch(rrBatchChange)
 	if err := rrBatchChangeRequest.Validate(); err != nil {
 		return fmt.Errorf("resource record change batch validation error: %s", err)
 	}
+	submittedAt := time.Now()
 	rrBatchResponse, err := svc.ChangeResourceRecordSets(rrBatchChangeRequest)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			case route53.ErrCodeNoSuchHostedZone:
-				return fmt.Errorf("zone id %s not found: %s", p.ZoneID, aerr.Error())
+				p.forgetHostedZone(zone.id)
+				return fmt.Errorf("zone id %s not found: %s", zone.id, aerr.Error())
 			case route53.ErrCodeInvalidInput:
-				return fmt.Errorf("invalid resource record change batch input in zone id %s: %s", p.ZoneID, aerr.Error())
+				return fmt.Errorf("invalid resource record change batch input in zone id %s: %s", zone.id, aerr.Error())
 			case route53.ErrCodeInvalidChangeBatch:
-				return fmt.Errorf("invalid resource record change batch in zone id %s: %s", p.ZoneID, aerr.Error())
+				return fmt.Errorf("invalid resource record change batch in zone id %s: %s", zone.id, aerr.Error())
 			}
 		}
 		return fmt.Errorf("resource record change batch request failed: %s", err.Error())
@@ -301,13 +312,361 @@ func (p *RegistrationProvider) Register(r *record.RegistrationRecord) error {
 
 	p.log.Info(
 		"dns resource record updated",
-		zap.String("zone_id", p.ZoneID),
+		zap.String("zone_id", zone.id),
 		// zap.String("record_set", rrSet.String()),
 		zap.String("status", *rrBatchResponse.ChangeInfo.Status),
 		zap.String("hostname", hostname),
 		zap.String("fqdn", fqdn),
-		zap.String("ip4", ip4),
+		zap.String("type", rrType),
+		zap.String("address", addr),
 	)
 
+	if p.WaitForSync {
+		if err := p.waitForSync(svc, zone.id, rrBatchResponse.ChangeInfo, submittedAt); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// waitForSync polls the status of the provided change until the change
+// propagates to all Route 53 DNS servers, or the sync timeout expires. The
+// status is checked one last time at the deadline.
+func (p *RegistrationProvider) waitForSync(svc *route53.Route53, zoneID string, changeInfo *route53.ChangeInfo, submittedAt time.Time) error {
+	changeID := aws.StringValue(changeInfo.Id)
+	status := aws.StringValue(changeInfo.Status)
+	timeout := time.Duration(p.SyncTimeout) * time.Second
+	deadline := submittedAt.Add(timeout)
+	for status != route53.ChangeStatusInsync {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("dns record change %s is not in sync after %s, status: %s", changeID, timeout, status)
+		}
+		interval := p.syncInterval
+		if interval > remaining {
+			interval = remaining
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-p.stop:
+			timer.Stop()
+			return fmt.Errorf("waiting for dns record change %s interrupted, status: %s", changeID, status)
+		}
+
+		changeRequest := &route53.GetChangeInput{}
+		changeRequest.SetId(changeID)
+		changeResponse, err := svc.GetChange(changeRequest)
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == route53.ErrCodeNoSuchChange {
+				return fmt.Errorf("dns record change %s not found: %s", changeID, aerr.Error())
+			}
+			return fmt.Errorf("get change request for dns record change %s failed: %s", changeID, err.Error())
+		}
+		status = aws.StringValue(changeResponse.ChangeInfo.Status)
+		p.log.Debug(
+			"dns record change status",
+			zap.String("zone_id", zoneID),
+			zap.String("change_id", changeID),
+			zap.String("status", status),
+		)
+	}
+
+	p.log.Info(
+		"dns record change is in sync",
+		zap.String("zone_id", zoneID),
+		zap.String("change_id", changeID),
+		zap.Duration("latency", time.Since(submittedAt)),
+	)
+	return nil
+}
+
+// Lookup returns the addresses of the provided IP version of a record
+// registered with RegistrationProvider.
+func (p *RegistrationProvider) Lookup(r *record.RegistrationRecord, version int) ([]string, error) {
+	if r.Name == "" {
+		return nil, fmt.Errorf("record name is empty")
+	}
+	rrType, err := record.GetRecordType(version)
+	if err != nil {
+		return nil, err
+	}
+	fqdn := r.Name
+	if !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+
+	svc, err := p.newService()
+	if err != nil {
+		return nil, err
+	}
+
+	zone, err := p.getHostedZone(svc, fqdn)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.listRecordValues(svc, zone.id, fqdn, rrType)
+}
+
+// listRecordValues returns the values of the resource record sets with the
+// provided name and type. The listing starts at the record, and follows the
+// pages while the record sets match, e.g. the record sets with routing
+// policies.
+func (p *RegistrationProvider) listRecordValues(svc *route53.Route53, zoneID, fqdn, rrType string) ([]string, error) {
+	values := []string{}
+	recordSetRequest := &route53.ListResourceRecordSetsInput{}
+	recordSetRequest.SetHostedZoneId(zoneID)
+	recordSetRequest.SetStartRecordName(fqdn)
+	recordSetRequest.SetStartRecordType(rrType)
+	recordSetRequest.SetMaxItems(p.pageSize)
+	for {
+		if err := recordSetRequest.Validate(); err != nil {
+			return nil, fmt.Errorf("list resource record sets request validation error: %s", err)
+		}
+		recordSetResponse, err := svc.ListResourceRecordSets(recordSetRequest)
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				switch aerr.Code() {
+				case route53.ErrCodeNoSuchHostedZone:
+					p.forgetHostedZone(zoneID)
+					return nil, fmt.Errorf("zone id %s not found: %s", zoneID, aerr.Error())
+				case route53.ErrCodeInvalidInput:
+					return nil, fmt.Errorf("invalid list resource record sets request in zone id %s: %s", zoneID, aerr.Error())
+				default:
+					return nil, fmt.Errorf("list resource record sets request failed: %s", aerr.Error())
+				}
+			}
+			return nil, fmt.Errorf("list resource record sets request failed: %s", err.Error())
+		}
+
+		for _, rrset := range recordSetResponse.ResourceRecordSets {
+			if !strings.EqualFold(unescapeName(aws.StringValue(rrset.Name)), fqdn) || aws.StringValue(rrset.Type) != rrType {
+				// The record sets are sorted, and the ones past the
+				// record do not match.
+				return values, nil
+			}
+			for _, rr := range rrset.ResourceRecords {
+				values = append(values, aws.StringValue(rr.Value))
+			}
+		}
+
+		if !aws.BoolValue(recordSetResponse.IsTruncated) {
+			return values, nil
+		}
+		recordSetRequest.StartRecordName = recordSetResponse.NextRecordName
+		recordSetRequest.StartRecordType = recordSetResponse.NextRecordType
+		recordSetRequest.StartRecordIdentifier = recordSetResponse.NextRecordIdentifier
+	}
+}
+
+// unescapeName returns the provided name of a resource record set with the
+// escape codes replaced by the characters. Route 53 returns the characters
+// other than letters, digits, hyphens and underscores as octal codes, e.g.
+// \052 for the asterisk of a wildcard record.
+func unescapeName(name string) string {
+	if !strings.Contains(name, `\`) {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+4 <= len(name) {
+			if c, err := strconv.ParseUint(name[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// getHostedZone returns the hosted zone of the provided record. With zone_id,
+// the zone must contain the record. Otherwise, the zone is discovered. The
+// zone of the record is cached until Route 53 reports it missing.
+func (p *RegistrationProvider) getHostedZone(svc *route53.Route53, fqdn string) (*hostedZone, error) {
+	key := strings.ToLower(fqdn)
+	p.mu.Lock()
+	zone, exists := p.zones[key]
+	p.mu.Unlock()
+	if exists {
+		return zone, nil
+	}
+
+	if p.ZoneID != "" {
+		hostedZoneResponse, err := p.getHostedZoneByID(svc, p.ZoneID)
+		if err != nil {
+			return nil, err
+		}
+		name := aws.StringValue(hostedZoneResponse.HostedZone.Name)
+		if !dns.IsSubDomain(name, fqdn) {
+			return nil, fmt.Errorf("record %s is not in hosted zone %s (zone id %s)", fqdn, name, p.ZoneID)
+		}
+		zone = &hostedZone{id: p.ZoneID, name: name}
+		p.mu.Lock()
+		p.zones[key] = zone
+		p.mu.Unlock()
+		p.log.Debug(
+			"dns zone found",
+			zap.String("zone_id", p.ZoneID),
+			zap.String("domain", strings.TrimRight(name, ".")),
+		)
+		return zone, nil
+	}
+
+	labels := dns.SplitDomainName(fqdn)
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("invalid record name %s", fqdn)
+	}
+	// The zones with longer names are more specific, so the names the
+	// record belongs to are looked up starting with the record itself.
+	for i := range labels {
+		zones, err := p.listHostedZones(svc, dns.Fqdn(strings.Join(labels[i:], ".")))
+		if err != nil {
+			return nil, err
+		}
+		for _, z := range zones {
+			private := z.Config != nil && aws.BoolValue(z.Config.PrivateZone)
+			if private != (p.VPCID != "") {
+				continue
+			}
+			id := strings.TrimPrefix(aws.StringValue(z.Id), "/hostedzone/")
+			if private {
+				associated, err := p.isAssociated(svc, id)
+				if err != nil {
+					return nil, err
+				}
+				if !associated {
+					continue
+				}
+			}
+			zone = &hostedZone{id: id, name: aws.StringValue(z.Name)}
+			p.mu.Lock()
+			p.zones[key] = zone
+			p.mu.Unlock()
+			p.log.Info(
+				"dns zone discovered",
+				zap.String("zone_id", zone.id),
+				zap.String("domain", strings.TrimRight(zone.name, ".")),
+				zap.Bool("private", private),
+				zap.String("fqdn", fqdn),
+			)
+			return zone, nil
+		}
+	}
+
+	if p.VPCID != "" {
+		return nil, fmt.Errorf("no private hosted zone associated with vpc %s found for record %s", p.VPCID, fqdn)
+	}
+	return nil, fmt.Errorf("no public hosted zone found for record %s", fqdn)
+}
+
+// forgetHostedZone drops the records of the provided hosted zone from the
+// cache, e.g. after the zone was deleted.
+func (p *RegistrationProvider) forgetHostedZone(zoneID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, zone := range p.zones {
+		if zone.id == zoneID {
+			delete(p.zones, key)
+		}
+	}
+}
+
+// listHostedZones returns the hosted zones with the provided name. The
+// zones are sorted by name with reversed labels, so the listing starts at
+// the zones with the name, and ends at the first zone with other name.
+func (p *RegistrationProvider) listHostedZones(svc *route53.Route53, name string) ([]*route53.HostedZone, error) {
+	zones := []*route53.HostedZone{}
+	hostedZonesRequest := &route53.ListHostedZonesByNameInput{}
+	hostedZonesRequest.SetDNSName(name)
+	hostedZonesRequest.SetMaxItems(p.pageSize)
+	for {
+		hostedZonesResponse, err := svc.ListHostedZonesByName(hostedZonesRequest)
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				switch aerr.Code() {
+				case route53.ErrCodeInvalidDomainName, route53.ErrCodeInvalidInput:
+					return nil, fmt.Errorf("invalid list hosted zones request for %s: %s", name, aerr.Error())
+				default:
+					return nil, fmt.Errorf("list hosted zones request failed: %s", aerr.Error())
+				}
+			}
+			return nil, fmt.Errorf("list hosted zones request failed: %s", err.Error())
+		}
+		for _, z := range hostedZonesResponse.HostedZones {
+			if !strings.EqualFold(unescapeName(aws.StringValue(z.Name)), name) {
+				return zones, nil
+			}
+			zones = append(zones, z)
+		}
+		if !aws.BoolValue(hostedZonesResponse.IsTruncated) {
+			return zones, nil
+		}
+		hostedZonesRequest.DNSName = hostedZonesResponse.NextDNSName
+		hostedZonesRequest.HostedZoneId = hostedZonesResponse.NextHostedZoneId
+	}
+}
+
+// isAssociated returns true when the provided private hosted zone is
+// associated with the configured VPC.
+func (p *RegistrationProvider) isAssociated(svc *route53.Route53, zoneID string) (bool, error) {
+	hostedZoneResponse, err := p.getHostedZoneByID(svc, zoneID)
+	if err != nil {
+		return false, err
+	}
+	for _, vpc := range hostedZoneResponse.VPCs {
+		if aws.StringValue(vpc.VPCId) != p.VPCID {
+			continue
+		}
+		if p.VPCRegion != "" && aws.StringValue(vpc.VPCRegion) != p.VPCRegion {
+			continue
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// getHostedZoneByID returns information about the hosted zone with the
+// provided id.
+func (p *RegistrationProvider) getHostedZoneByID(svc *route53.Route53, zoneID string) (*route53.GetHostedZoneOutput, error) {
+	hostedZoneRequest := &route53.GetHostedZoneInput{
+		Id: aws.String(zoneID),
+	}
+	hostedZoneResponse, err := svc.GetHostedZone(hostedZoneRequest)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case route53.ErrCodeNoSuchHostedZone:
+				return nil, fmt.Errorf("zone id %s not found: %s", zoneID, aerr.Error())
+			case route53.ErrCodeInvalidInput:
+				return nil, fmt.Errorf("invalid get hosted zone request in zone id %s: %s", zoneID, aerr.Error())
+			default:
+				return nil, fmt.Errorf("get hosted zone request failed: %s", aerr.Error())
+			}
+		}
+		return nil, fmt.Errorf("get hosted zone request failed: %s", err.Error())
+	}
+	if hostedZoneResponse.HostedZone == nil {
+		return nil, fmt.Errorf("get hosted zone request returned nil")
+	}
+	return hostedZoneResponse, nil
+}
+
+// newService returns Route 53 client.
+func (p *RegistrationProvider) newService() (*route53.Route53, error) {
+	cfg := &aws.Config{
+		Region:      aws.String(p.region),
+		Credentials: credentials.NewStaticCredentials(p.accessKeyID, p.secretAccessKey, ""),
+	}
+	if p.Endpoint != "" {
+		cfg.Endpoint = aws.String(p.Endpoint)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed create aws session: %s", err)
+	}
+	return route53.New(sess), nil
+}
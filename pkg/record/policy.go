@@ -0,0 +1,140 @@
+package record
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// specialNetwork is an address range not routable on the public Internet.
+type specialNetwork struct {
+	name    string
+	network *net.IPNet
+}
+
+// specialNetworks are the address ranges rejected by the policies with
+// reject_special enabled.
+var specialNetworks = []specialNetwork{
+	newSpecialNetwork("unspecified", "0.0.0.0/8"),
+	newSpecialNetwork("private", "10.0.0.0/8"),
+	newSpecialNetwork("cgnat", "100.64.0.0/10"),
+	newSpecialNetwork("loopback", "127.0.0.0/8"),
+	newSpecialNetwork("link-local", "169.254.0.0/16"),
+	newSpecialNetwork("private", "172.16.0.0/12"),
+	newSpecialNetwork("documentation", "192.0.2.0/24"),
+	newSpecialNetwork("private", "192.168.0.0/16"),
+	newSpecialNetwork("benchmarking", "198.18.0.0/15"),
+	newSpecialNetwork("documentation", "198.51.100.0/24"),
+	newSpecialNetwork("documentation", "203.0.113.0/24"),
+	newSpecialNetwork("multicast", "224.0.0.0/4"),
+	newSpecialNetwork("reserved", "240.0.0.0/4"),
+	newSpecialNetwork("unspecified", "::/128"),
+	newSpecialNetwork("loopback", "::1/128"),
+	newSpecialNetwork("documentation", "2001:db8::/32"),
+	newSpecialNetwork("unique-local", "fc00::/7"),
+	newSpecialNetwork("link-local", "fe80::/10"),
+	newSpecialNetwork("multicast", "ff00::/8"),
+}
+
+func newSpecialNetwork(name, cidr string) specialNetwork {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return specialNetwork{name: name, network: network}
+}
+
+// AddressPolicy restricts the addresses published for a record. An address
+// in the deny list is rejected. When the allow list is not empty, an address
+// outside of it is rejected. With reject_special enabled, the addresses not
+// routable on the public Internet, e.g. RFC 1918, CGNAT, loopback,
+// link-local, and documentation ranges, are rejected unless they are in the
+// allow list.
+type AddressPolicy struct {
+	Allow         []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny          []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+	RejectSpecial bool     `json:"reject_special,omitempty" yaml:"reject_special,omitempty"`
+	allow         []*net.IPNet
+	deny          []*net.IPNet
+}
+
+// Validate validates AddressPolicy.
+func (p *AddressPolicy) Validate() error {
+	var err error
+	if p.allow, err = parseNetworks(p.Allow); err != nil {
+		return fmt.Errorf("invalid allow list: %s", err)
+	}
+	if p.deny, err = parseNetworks(p.Deny); err != nil {
+		return fmt.Errorf("invalid deny list: %s", err)
+	}
+	return nil
+}
+
+// parseNetworks parses the provided CIDRs. An address without prefix
+// length is a network with the single address.
+func parseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, s := range cidrs {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid cidr %q", s)
+			}
+			if ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q", s)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Check returns an error when the policy rejects the provided address.
+func (p *AddressPolicy) Check(addr string) error {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return fmt.Errorf("invalid ip address %q", addr)
+	}
+	for _, network := range p.deny {
+		if network.Contains(ip) {
+			return fmt.Errorf("address %s is in denied network %s", addr, network)
+		}
+	}
+	var allowed bool
+	for _, network := range p.allow {
+		if network.Contains(ip) {
+			allowed = true
+			break
+		}
+	}
+	if len(p.allow) > 0 && !allowed {
+		return fmt.Errorf("address %s is not in allowed networks", addr)
+	}
+	if p.RejectSpecial && !allowed {
+		for _, special := range specialNetworks {
+			if special.network.Contains(ip) {
+				return fmt.Errorf("address %s is in %s network %s", addr, special.name, special.network)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckAddress returns an error when the address policy of the record
+// rejects the provided address.
+func (r *RegistrationRecord) CheckAddress(addr string) error {
+	if r.Policy == nil {
+		return nil
+	}
+	if err := r.Policy.Check(addr); err != nil {
+		return fmt.Errorf("address rejected by policy: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package record
+
+import (
+	"testing"
+)
+
+func TestAddressPolicy(t *testing.T) {
+	testcases := []struct {
+		name      string
+		policy    *AddressPolicy
+		addr      string
+		shouldErr bool
+	}{
+		{name: "no restrictions", policy: &AddressPolicy{}, addr: "10.0.0.1"},
+		{name: "public ipv4 address", policy: &AddressPolicy{RejectSpecial: true}, addr: "8.8.8.8"},
+		{name: "public ipv6 address", policy: &AddressPolicy{RejectSpecial: true}, addr: "2606:4700::1111"},
+		{name: "rfc1918 address", policy: &AddressPolicy{RejectSpecial: true}, addr: "10.1.2.3", shouldErr: true},
+		{name: "rfc1918 172.16/12 address", policy: &AddressPolicy{RejectSpecial: true}, addr: "172.31.0.1", shouldErr: true},
+		{name: "cgnat address", policy: &AddressPolicy{RejectSpecial: true}, addr: "100.64.1.1", shouldErr: true},
+		{name: "loopback address", policy: &AddressPolicy{RejectSpecial: true}, addr: "127.0.0.1", shouldErr: true},
+		{name: "ipv6 loopback address", policy: &AddressPolicy{RejectSpecial: true}, addr: "::1", shouldErr: true},
+		{name: "link-local address", policy: &AddressPolicy{RejectSpecial: true}, addr: "169.254.169.254", shouldErr: true},
+		{name: "ipv6 link-local address", policy: &AddressPolicy{RejectSpecial: true}, addr: "fe80::1", shouldErr: true},
+		{name: "documentation address", policy: &AddressPolicy{RejectSpecial: true}, addr: "203.0.113.10", shouldErr: true},
+		{name: "ipv6 documentation address", policy: &AddressPolicy{RejectSpecial: true}, addr: "2001:db8::10", shouldErr: true},
+		{name: "unique local address", policy: &AddressPolicy{RejectSpecial: true}, addr: "fd00::1", shouldErr: true},
+		{name: "denied address", policy: &AddressPolicy{Deny: []string{"198.51.100.0/24"}}, addr: "198.51.100.7", shouldErr: true},
+		{name: "denied single address", policy: &AddressPolicy{Deny: []string{"8.8.8.8"}}, addr: "8.8.8.8", shouldErr: true},
+		{name: "allowed address", policy: &AddressPolicy{Allow: []string{"198.51.100.0/24"}}, addr: "198.51.100.7"},
+		{name: "address outside allowed networks", policy: &AddressPolicy{Allow: []string{"198.51.100.0/24"}}, addr: "8.8.8.8", shouldErr: true},
+		{
+			name:   "allowed special address",
+			policy: &AddressPolicy{Allow: []string{"10.0.0.0/8"}, RejectSpecial: true},
+			addr:   "10.1.2.3",
+		},
+		{
+			name:      "deny takes precedence over allow",
+			policy:    &AddressPolicy{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.1.0.0/16"}},
+			addr:      "10.1.2.3",
+			shouldErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.policy.Validate(); err != nil {
+				t.Fatalf("unexpected validation error: %s", err)
+			}
+			err := tc.policy.Check(tc.addr)
+			if tc.shouldErr && err == nil {
+				t.Fatalf("expected address %s to be rejected", tc.addr)
+			}
+			if !tc.shouldErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestAddressPolicyValidate(t *testing.T) {
+	for _, policy := range []*AddressPolicy{
+		{Allow: []string{"10.0.0.0/33"}},
+		{Deny: []string{"foo"}},
+	} {
+		if err := policy.Validate(); err == nil {
+			t.Fatalf("expected validation error for %v", policy)
+		}
+	}
+}
+
+func TestRecordCheckAddress(t *testing.T) {
+	r := &RegistrationRecord{Name: "app.contoso.com"}
+	if err := r.CheckAddress("10.1.2.3"); err != nil {
+		t.Fatalf("unexpected error for record without policy: %s", err)
+	}
+	r.Policy = &AddressPolicy{RejectSpecial: true}
+	if err := r.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %s", err)
+	}
+	if err := r.CheckAddress("10.1.2.3"); err == nil {
+		t.Fatalf("expected address to be rejected by policy")
+	}
+}
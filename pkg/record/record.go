@@ -2,17 +2,40 @@ package record
 
 import (
 	"fmt"
+	"sync"
+	"time"
+)
+
+// Registration states of a record.
+const (
+	StateUpToDate = "up_to_date"
+	StateUpdated  = "updated"
+	StateFailed   = "failed"
 )
 
 // RegistrationRecord represents DNS record entry.
 type RegistrationRecord struct {
-	Name       string `json:"name" yaml:"name"`
-	Type       string `json:"type" yaml:"type"`
-	TimeToLive uint64 `json:"ttl" yaml:"ttl"`
-	Version4   bool   `json:"v4" yaml:"v4"`
-	Version6   bool   `json:"v6" yaml:"v6"`
+	Name       string         `json:"name" yaml:"name"`
+	Type       string         `json:"type" yaml:"type"`
+	TimeToLive uint64         `json:"ttl" yaml:"ttl"`
+	Provider   string         `json:"provider,omitempty" yaml:"provider,omitempty"`
+	Policy     *AddressPolicy `json:"policy,omitempty" yaml:"policy,omitempty"`
+	Version4   bool           `json:"v4" yaml:"v4"`
+	Version6   bool           `json:"v6" yaml:"v6"`
 	ip4        string
 	ip6        string
+	mu         sync.Mutex
+	status     map[int]*RegistrationStatus
+}
+
+// RegistrationStatus is the outcome of the last registration attempt
+// of a record for an IP version.
+type RegistrationStatus struct {
+	Version   int       `json:"ip_version"`
+	State     string    `json:"state"`
+	Address   string    `json:"address,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 // Validate validates RegistrationRecord.
@@ -38,6 +61,11 @@ func (r *RegistrationRecord) Validate() error {
 	if r.TimeToLive == 0 {
 		r.TimeToLive = 600
 	}
+	if r.Policy != nil {
+		if err := r.Policy.Validate(); err != nil {
+			return fmt.Errorf("dns record %s address policy is invalid: %s", r.Name, err)
+		}
+	}
 	return nil
 }
 
@@ -72,3 +100,64 @@ func (r *RegistrationRecord) GetAddress(version int) (string, error) {
 	}
 	return r.ip6, nil
 }
+
+// GetVersions returns IP versions enabled for the record.
+func (r *RegistrationRecord) GetVersions() []int {
+	versions := []int{}
+	if r.Version4 {
+		versions = append(versions, 4)
+	}
+	if r.Version6 {
+		versions = append(versions, 6)
+	}
+	return versions
+}
+
+// GetRecordType returns DNS resource record type for the provided IP version.
+func GetRecordType(version int) (string, error) {
+	if err := validVersion(version); err != nil {
+		return "", err
+	}
+	if version == 4 {
+		return "A", nil
+	}
+	return "AAAA", nil
+}
+
+// SetStatus sets the outcome of the last registration attempt for the
+// provided IP version. It returns true when the state differs from the
+// previously recorded one.
+func (r *RegistrationRecord) SetStatus(version int, state, addr string, err error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status == nil {
+		r.status = make(map[int]*RegistrationStatus)
+	}
+	status := &RegistrationStatus{
+		Version:   version,
+		State:     state,
+		Address:   addr,
+		Timestamp: time.Now(),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	prev, exists := r.status[version]
+	r.status[version] = status
+	if !exists {
+		return true
+	}
+	return prev.State != status.State || prev.Address != status.Address || prev.Error != status.Error
+}
+
+// GetStatus returns the outcome of the last registration attempt for the
+// provided IP version, or nil when the record has not been registered yet.
+func (r *RegistrationRecord) GetStatus(version int) *RegistrationStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if status, exists := r.status[version]; exists {
+		s := *status
+		return &s
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Package registry holds the generic registry of factories creating
+// instances by type name, e.g. DNS provider engines and address sources.
+// The packages of the instances register a factory for each type name in
+// init, and the configuration decoder creates the instances by the type
+// name found in the configuration.
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry holds the factories of T registered under type names.
+type Registry[T any] struct {
+	pkg       string
+	kind      string
+	desc      string
+	mu        sync.RWMutex
+	factories map[string]func() T
+}
+
+// New returns an instance of Registry. The package name prefixes the panic
+// messages, and the kind, e.g. provider, with its description, e.g. dns
+// provider, names the instances in the messages.
+func New[T any](pkg, kind, desc string) *Registry[T] {
+	return &Registry[T]{
+		pkg:       pkg,
+		kind:      kind,
+		desc:      desc,
+		factories: make(map[string]func() T),
+	}
+}
+
+// Register makes the instances created by the factory available under the
+// provided type name. It panics if the name is empty, the factory is nil,
+// or the name is already registered.
+func (r *Registry[T]) Register(name string, factory func() T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name == "" {
+		panic(r.pkg + ": " + r.kind + " type name is empty")
+	}
+	if factory == nil {
+		panic(r.pkg + ": factory for " + r.kind + " " + name + " is nil")
+	}
+	if _, exists := r.factories[name]; exists {
+		panic(r.pkg + ": " + r.kind + " " + name + " is already registered")
+	}
+	r.factories[name] = factory
+}
+
+// New returns a new instance registered under the provided type name.
+func (r *Registry[T]) New(name string) (T, error) {
+	r.mu.RLock()
+	factory, exists := r.factories[name]
+	r.mu.RUnlock()
+	if !exists {
+		var empty T
+		if name == "" {
+			return empty, fmt.Errorf("%s type not found, available %ss: %s", r.desc, r.kind, strings.Join(r.Names(), ", "))
+		}
+		return empty, fmt.Errorf("unsupported %s type %q, available %ss: %s", r.desc, name, r.kind, strings.Join(r.Names(), ", "))
+	}
+	return factory(), nil
+}
+
+// Names returns sorted registered type names.
+func (r *Registry[T]) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := []string{}
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,57 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := New[string]("test", "widget", "test widget")
+	r.Register("foo", func() string { return "foo instance" })
+	r.Register("bar", func() string { return "bar instance" })
+
+	if names := strings.Join(r.Names(), ","); names != "bar,foo" {
+		t.Fatalf("unexpected names: %s", names)
+	}
+
+	v, err := r.New("foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if v != "foo instance" {
+		t.Fatalf("unexpected instance: %s", v)
+	}
+
+	testcases := []struct {
+		name string
+		want string
+	}{
+		{name: "", want: `test widget type not found, available widgets: bar, foo`},
+		{name: "baz", want: `unsupported test widget type "baz", available widgets: bar, foo`},
+	}
+	for _, tc := range testcases {
+		if _, err := r.New(tc.name); err == nil || err.Error() != tc.want {
+			t.Fatalf("unexpected error: %v (actual) vs. %s (expected)", err, tc.want)
+		}
+	}
+
+	panics := []struct {
+		name    string
+		factory func() string
+		want    string
+	}{
+		{name: "", factory: func() string { return "" }, want: "test: widget type name is empty"},
+		{name: "baz", want: "test: factory for widget baz is nil"},
+		{name: "foo", factory: func() string { return "" }, want: "test: widget foo is already registered"},
+	}
+	for _, tc := range panics {
+		func() {
+			defer func() {
+				if v := recover(); v != tc.want {
+					t.Fatalf("unexpected panic: %v (actual) vs. %s (expected)", v, tc.want)
+				}
+			}()
+			r.Register(tc.name, tc.factory)
+		}()
+	}
+}
@@ -0,0 +1,166 @@
+package sources
+
+import (
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/utils"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+	"net"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterFactory("dns", func() Source {
+		return &DNSSource{}
+	})
+}
+
+// dnsResolverPresets are the well-known DNS services reporting the address
+// of the client.
+var dnsResolverPresets = map[string]DNSSource{
+	"opendns": {
+		Server: "resolver1.opendns.com",
+		Name:   "myip.opendns.com",
+	},
+	"google": {
+		Server:     "ns1.google.com",
+		Name:       "o-o.myaddr.l.google.com",
+		RecordType: "TXT",
+	},
+}
+
+// DNSSource is a DNS service reporting the address of the client, e.g.
+// an A query for myip.opendns.com sent to resolver1.opendns.com, or a TXT
+// query for o-o.myaddr.l.google.com sent to ns1.google.com. The queries
+// are sent over IPv4 or IPv6 depending on the requested IP version.
+type DNSSource struct {
+	Source     string `json:"type" yaml:"type"`
+	Resolver   string `json:"resolver,omitempty" yaml:"resolver,omitempty"`
+	Server     string `json:"server,omitempty" yaml:"server,omitempty"`
+	Name       string `json:"name,omitempty" yaml:"name,omitempty"`
+	RecordType string `json:"record_type,omitempty" yaml:"record_type,omitempty"`
+	Versions   []int  `json:"versions,omitempty" yaml:"versions,omitempty"`
+	Timeout    uint64 `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	log        *zap.Logger
+}
+
+// Validate validates an instance of *DNSSource.
+func (s *DNSSource) Validate() error {
+	if s.Resolver != "" {
+		if _, exists := dnsResolverPresets[s.Resolver]; !exists {
+			return fmt.Errorf("unsupported resolver %s, must be one of the following: opendns, google", s.Resolver)
+		}
+	} else {
+		if s.Server == "" {
+			return fmt.Errorf("source requires a resolver or a server")
+		}
+		if s.Name == "" {
+			return fmt.Errorf("source requires a name")
+		}
+	}
+	switch strings.ToUpper(s.RecordType) {
+	case "", "A", "AAAA", "TXT":
+	default:
+		return fmt.Errorf("unsupported record type %s, must be one of the following: A, AAAA, TXT", s.RecordType)
+	}
+	if err := validateVersions(s.Versions); err != nil {
+		return err
+	}
+	if s.Source != "dns" {
+		return fmt.Errorf("source mismatch: %s (config) vs. dns (expected)", s.Source)
+	}
+	return nil
+}
+
+// Configure configures an instance of *DNSSource.
+func (s *DNSSource) Configure(logger *zap.Logger) error {
+	s.log = logger
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if preset, exists := dnsResolverPresets[s.Resolver]; exists {
+		if s.Server == "" {
+			s.Server = preset.Server
+		}
+		if s.Name == "" {
+			s.Name = preset.Name
+		}
+		if s.RecordType == "" {
+			s.RecordType = preset.RecordType
+		}
+	}
+	s.RecordType = strings.ToUpper(s.RecordType)
+	if _, _, err := net.SplitHostPort(s.Server); err != nil {
+		s.Server = net.JoinHostPort(strings.Trim(s.Server, "[]"), "53")
+	}
+	if s.Timeout == 0 {
+		s.Timeout = 5
+	}
+	return nil
+}
+
+// GetSource returns the source type of DNSSource.
+func (s *DNSSource) GetSource() string {
+	return s.Source
+}
+
+// GetVersions returns the IP versions of the addresses provided by DNSSource.
+func (s *DNSSource) GetVersions() []int {
+	return getVersions(s.Versions)
+}
+
+// GetAddress returns the address of the provided IP version reported by
+// the DNS service.
+func (s *DNSSource) GetAddress(version int) (string, error) {
+	if !supportsVersion(s.Versions, version) {
+		return "", ErrVersionNotSupported
+	}
+	var network string
+	var qtype uint16
+	switch version {
+	case 4:
+		network = "udp4"
+		qtype = dns.TypeA
+	case 6:
+		network = "udp6"
+		qtype = dns.TypeAAAA
+	default:
+		return "", fmt.Errorf("invalid ip version %d", version)
+	}
+	if s.RecordType != "" {
+		qtype = dns.StringToType[s.RecordType]
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(s.Name), qtype)
+	client := &dns.Client{
+		Net:     network,
+		Timeout: time.Duration(s.Timeout) * time.Second,
+	}
+	resp, _, err := client.Exchange(req, s.Server)
+	if err != nil {
+		return "", fmt.Errorf("dns query for %s to %s failed: %s", s.Name, s.Server, err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return "", fmt.Errorf("dns query for %s to %s failed: %s", s.Name, s.Server, dns.RcodeToString[resp.Rcode])
+	}
+
+	for _, rr := range resp.Answer {
+		var values []string
+		switch t := rr.(type) {
+		case *dns.A:
+			values = []string{t.A.String()}
+		case *dns.AAAA:
+			values = []string{t.AAAA.String()}
+		case *dns.TXT:
+			values = t.Txt
+		}
+		for _, v := range values {
+			if addr, err := utils.ParseAddress(strings.TrimSpace(v), version); err == nil {
+				return addr, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("dns query for %s to %s returned no ip version %d address", s.Name, s.Server, version)
+}
@@ -0,0 +1,94 @@
+package sources
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// startDNSServer starts a DNS server on the provided local address and
+// returns the address it listens on.
+func startDNSServer(t *testing.T, addr string, handler dns.HandlerFunc) string {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Skipf("failed listening on %s: %s", addr, err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{
+		PacketConn:        pc,
+		Handler:           handler,
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+// echoHandler responds with the address of the client the way OpenDNS and
+// Google do.
+func echoHandler(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	q := req.Question[0]
+	ip := w.RemoteAddr().(*net.UDPAddr).IP
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 0}
+	switch {
+	case q.Name == "myip.opendns.com." && q.Qtype == dns.TypeA && ip.To4() != nil:
+		resp.Answer = append(resp.Answer, &dns.A{Hdr: hdr, A: ip})
+	case q.Name == "myip.opendns.com." && q.Qtype == dns.TypeAAAA && ip.To4() == nil:
+		resp.Answer = append(resp.Answer, &dns.AAAA{Hdr: hdr, AAAA: ip})
+	case q.Name == "o-o.myaddr.l.google.com." && q.Qtype == dns.TypeTXT:
+		resp.Answer = append(resp.Answer, &dns.TXT{Hdr: hdr, Txt: []string{ip.String()}})
+	default:
+		resp.Rcode = dns.RcodeNameError
+	}
+	w.WriteMsg(resp)
+}
+
+func TestDNSSource(t *testing.T) {
+	testcases := []struct {
+		name       string
+		listen     string
+		resolver   string
+		recordName string
+		version    int
+		want       string
+		shouldErr  bool
+	}{
+		{name: "opendns over ipv4", listen: "127.0.0.1:0", resolver: "opendns", version: 4, want: "127.0.0.1"},
+		{name: "google over ipv4", listen: "127.0.0.1:0", resolver: "google", version: 4, want: "127.0.0.1"},
+		{name: "opendns over ipv6", listen: "[::1]:0", resolver: "opendns", version: 6, want: "::1"},
+		{name: "google over ipv6", listen: "[::1]:0", resolver: "google", version: 6, want: "::1"},
+		{name: "nxdomain", listen: "127.0.0.1:0", recordName: "foo.contoso.com", version: 4, shouldErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := startDNSServer(t, tc.listen, echoHandler)
+			s := &DNSSource{
+				Source:   "dns",
+				Resolver: tc.resolver,
+				Server:   addr,
+				Name:     tc.recordName,
+			}
+			if err := s.Configure(zap.NewNop()); err != nil {
+				t.Fatalf("unexpected configuration error: %s", err)
+			}
+			got, err := s.GetAddress(tc.version)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Fatalf("unexpected address: %s (actual) vs. %s (expected)", got, tc.want)
+			}
+		})
+	}
+}
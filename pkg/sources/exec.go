@@ -0,0 +1,150 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/utils"
+	"go.uber.org/zap"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxStderrSize is the maximum size of the standard error of a command
+// included in error messages.
+const maxStderrSize = 512
+
+func init() {
+	RegisterFactory("exec", func() Source {
+		return &ExecSource{}
+	})
+}
+
+// ExecSource is a command printing the address to its standard output,
+// e.g. a vendor CLI or an SNMP script. The command inherits the environment
+// of the service, extended with the configured variables, and the
+// DYNDNS_IP_VERSION variable set to the requested IP version. The first
+// address of the requested IP version in the output is used.
+type ExecSource struct {
+	Source   string            `json:"type" yaml:"type"`
+	Command  string            `json:"command" yaml:"command"`
+	Args     []string          `json:"args,omitempty" yaml:"args,omitempty"`
+	Env      map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	Timeout  uint64            `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Versions []int             `json:"versions,omitempty" yaml:"versions,omitempty"`
+	log      *zap.Logger
+}
+
+// MarshalJSON packs configuration of ExecSource with the values of the
+// environment variables masked, as they usually hold credentials.
+func (s ExecSource) MarshalJSON() ([]byte, error) {
+	type config ExecSource
+	c := config(s)
+	if len(s.Env) > 0 {
+		c.Env = make(map[string]string, len(s.Env))
+		for k, v := range s.Env {
+			c.Env[k] = utils.MaskSecret(v, 2, 2)
+		}
+	}
+	return json.Marshal(c)
+}
+
+// Validate validates an instance of *ExecSource.
+func (s *ExecSource) Validate() error {
+	if s.Command == "" {
+		return fmt.Errorf("source requires a command")
+	}
+	for k := range s.Env {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			return fmt.Errorf("invalid environment variable name %q", k)
+		}
+	}
+	if err := validateVersions(s.Versions); err != nil {
+		return err
+	}
+	if s.Source != "exec" {
+		return fmt.Errorf("source mismatch: %s (config) vs. exec (expected)", s.Source)
+	}
+	return nil
+}
+
+// Configure configures an instance of *ExecSource.
+func (s *ExecSource) Configure(logger *zap.Logger) error {
+	s.log = logger
+	if s.Timeout == 0 {
+		s.Timeout = 10
+	}
+	return s.Validate()
+}
+
+// GetSource returns the source type of ExecSource.
+func (s *ExecSource) GetSource() string {
+	return s.Source
+}
+
+// GetVersions returns the IP versions of the addresses provided by ExecSource.
+func (s *ExecSource) GetVersions() []int {
+	return getVersions(s.Versions)
+}
+
+// GetAddress returns the address of the provided IP version printed by the
+// command.
+func (s *ExecSource) GetAddress(version int) (string, error) {
+	if !supportsVersion(s.Versions, version) {
+		return "", ErrVersionNotSupported
+	}
+
+	timeout := time.Duration(s.Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.Command, s.Args...)
+	cmd.Env = append(os.Environ(), "DYNDNS_IP_VERSION="+strconv.Itoa(version))
+	for k, v := range s.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// The children of the command may keep the output open after the
+	// command is killed.
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("command %s timed out after %s", s.Command, timeout)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("command %s exited with code %d, stderr: %s", s.Command, exitErr.ExitCode(), formatStderr(stderr.Bytes()))
+		}
+		return "", fmt.Errorf("command %s failed: %s", s.Command, err)
+	}
+
+	for _, field := range strings.Fields(stdout.String()) {
+		if addr, err := utils.ParseAddress(field, version); err == nil {
+			return addr, nil
+		}
+	}
+	if stderr.Len() > 0 {
+		return "", fmt.Errorf("command %s output has no ipv%d address, stderr: %s", s.Command, version, formatStderr(stderr.Bytes()))
+	}
+	return "", fmt.Errorf("command %s output has no ipv%d address", s.Command, version)
+}
+
+// formatStderr returns the trimmed tail of the standard error of a command.
+func formatStderr(b []byte) string {
+	s := strings.TrimSpace(string(b))
+	if len(s) > maxStderrSize {
+		s = "..." + s[len(s)-maxStderrSize:]
+	}
+	if s == "" {
+		return "<empty>"
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+package sources
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestExecSource(t *testing.T) {
+	testcases := []struct {
+		name      string
+		script    string
+		env       map[string]string
+		timeout   uint64
+		version   int
+		want      string
+		shouldErr bool
+		errSubstr string
+	}{
+		{name: "ipv4 address", script: `echo 203.0.113.10`, version: 4, want: "203.0.113.10"},
+		{
+			name:    "address of requested version",
+			script:  `if [ "$DYNDNS_IP_VERSION" = 6 ]; then echo 2001:db8::10; else echo 203.0.113.10; fi`,
+			version: 6,
+			want:    "2001:db8::10",
+		},
+		{
+			name:    "address in output with text",
+			script:  `echo "WAN: up"; echo "WAN IP: 203.0.113.10 (dhcp)"`,
+			version: 4,
+			want:    "203.0.113.10",
+		},
+		{name: "environment", script: `echo $WAN_ADDR`, env: map[string]string{"WAN_ADDR": "203.0.113.10"}, version: 4, want: "203.0.113.10"},
+		{
+			name:      "exit code and stderr",
+			script:    `echo "snmp timeout" >&2; exit 3`,
+			version:   4,
+			shouldErr: true,
+			errSubstr: "exited with code 3, stderr: snmp timeout",
+		},
+		{name: "no address", script: `echo unknown`, version: 4, shouldErr: true, errSubstr: "has no ipv4 address"},
+		{name: "timeout", script: `sleep 5`, timeout: 1, version: 4, shouldErr: true, errSubstr: "timed out after 1s"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &ExecSource{
+				Source:  "exec",
+				Command: "/bin/sh",
+				Args:    []string{"-c", tc.script},
+				Env:     tc.env,
+				Timeout: tc.timeout,
+			}
+			if err := s.Configure(zap.NewNop()); err != nil {
+				t.Fatalf("unexpected configuration error: %s", err)
+			}
+			addr, err := s.GetAddress(tc.version)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", addr)
+				}
+				if !strings.Contains(err.Error(), tc.errSubstr) {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if addr != tc.want {
+				t.Fatalf("unexpected address: %s (actual) vs. %s (expected)", addr, tc.want)
+			}
+		})
+	}
+}
+
+func TestExecSourceMarshalJSON(t *testing.T) {
+	s := &ExecSource{
+		Source:  "exec",
+		Command: "snmpget",
+		Env:     map[string]string{"SNMP_COMMUNITY": "community1234"},
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(string(b), "community1234") {
+		t.Fatalf("environment variable value is not masked: %s", b)
+	}
+	if !strings.Contains(string(b), "SNMP_COMMUNITY") || !strings.Contains(string(b), "snmpget") {
+		t.Fatalf("unexpected configuration: %s", b)
+	}
+	if s.Env["SNMP_COMMUNITY"] != "community1234" {
+		t.Fatalf("source environment modified: %v", s.Env)
+	}
+}
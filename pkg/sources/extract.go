@@ -0,0 +1,123 @@
+package sources
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/utils"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is a step of a JSON path. It is either the key of an object,
+// or the index of an array.
+type jsonPathStep struct {
+	key   string
+	index int
+}
+
+// parseJSONPath parses a JSON path in dot notation, e.g. $.data.ip,
+// addresses[0], or data.interfaces[1].address.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	p := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if p == "" {
+		return nil, fmt.Errorf("invalid json path %s", path)
+	}
+	steps := []jsonPathStep{}
+	for _, segment := range strings.Split(p, ".") {
+		key := segment
+		var indices []string
+		if i := strings.Index(segment, "["); i >= 0 {
+			key = segment[:i]
+			rest := segment[i:]
+			for rest != "" {
+				j := strings.Index(rest, "]")
+				if !strings.HasPrefix(rest, "[") || j < 0 {
+					return nil, fmt.Errorf("invalid json path %s", path)
+				}
+				indices = append(indices, rest[1:j])
+				rest = rest[j+1:]
+			}
+		}
+		if key == "" && (len(steps) > 0 || len(indices) == 0) {
+			return nil, fmt.Errorf("invalid json path %s", path)
+		}
+		if key != "" {
+			steps = append(steps, jsonPathStep{key: key, index: -1})
+		}
+		for _, s := range indices {
+			index, err := strconv.Atoi(s)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid json path %s, array index %q is not supported", path, s)
+			}
+			steps = append(steps, jsonPathStep{index: index})
+		}
+	}
+	return steps, nil
+}
+
+// extractJSONPath returns the address of the provided IP version found at
+// the JSON path in the provided document. When the path refers to an array,
+// the first address of the IP version is returned.
+func extractJSONPath(data []byte, path []jsonPathStep, version int) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "", fmt.Errorf("error parsing json response: %s", err)
+	}
+	for _, step := range path {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			if step.key == "" {
+				return "", fmt.Errorf("json path refers to an array index, but found an object")
+			}
+			value, exists := node[step.key]
+			if !exists {
+				return "", fmt.Errorf("json path key %s not found", step.key)
+			}
+			v = value
+		case []interface{}:
+			if step.key != "" {
+				return "", fmt.Errorf("json path refers to key %s, but found an array", step.key)
+			}
+			if step.index >= len(node) {
+				return "", fmt.Errorf("json path array index %d out of range", step.index)
+			}
+			v = node[step.index]
+		default:
+			return "", fmt.Errorf("json path refers to a scalar value")
+		}
+	}
+
+	switch value := v.(type) {
+	case string:
+		return utils.ParseAddress(strings.TrimSpace(value), version)
+	case []interface{}:
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				continue
+			}
+			if addr, err := utils.ParseAddress(strings.TrimSpace(s), version); err == nil {
+				return addr, nil
+			}
+		}
+		return "", fmt.Errorf("json path refers to an array without ipv%d address", version)
+	}
+	return "", fmt.Errorf("json path refers to a non-string value")
+}
+
+// extractRegex returns the first match of the provided regular expression
+// being an address of the provided IP version. When the expression has
+// a capture group, the first group is the address.
+func extractRegex(data []byte, re *regexp.Regexp, version int) (string, error) {
+	for _, match := range re.FindAllSubmatch(data, -1) {
+		s := match[0]
+		if len(match) > 1 {
+			s = match[1]
+		}
+		if addr, err := utils.ParseAddress(strings.TrimSpace(string(s)), version); err == nil {
+			return addr, nil
+		}
+	}
+	return "", fmt.Errorf("no ipv%d address matching regular expression %s", version, re)
+}
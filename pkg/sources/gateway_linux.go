@@ -0,0 +1,62 @@
+//go:build linux
+
+package sources
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// nativeEndian is the byte order of the host, the order of the addresses in
+// /proc/net/route.
+var nativeEndian = getNativeEndian()
+
+// getNativeEndian returns the byte order of the host.
+func getNativeEndian() binary.ByteOrder {
+	probe := uint16(1)
+	if *(*byte)(unsafe.Pointer(&probe)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// defaultGateway returns the IPv4 default gateway read from /proc/net/route.
+func defaultGateway() (net.IP, error) {
+	return readDefaultGateway("/proc/net/route", nativeEndian)
+}
+
+// readDefaultGateway returns the IPv4 default gateway read from the provided
+// routing table. The addresses in the table are hexadecimal numbers holding
+// the address in the provided byte order.
+func readDefaultGateway(path string, order binary.ByteOrder) (net.IP, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The fields are interface, destination, gateway, flags, etc.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil {
+			continue
+		}
+		ip := make(net.IP, 4)
+		order.PutUint32(ip, uint32(n))
+		if ip.IsUnspecified() {
+			continue
+		}
+		return ip, nil
+	}
+	return nil, fmt.Errorf("default route not found")
+}
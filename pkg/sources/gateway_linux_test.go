@@ -0,0 +1,67 @@
+//go:build linux
+
+package sources
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadDefaultGateway(t *testing.T) {
+	testcases := []struct {
+		name  string
+		order binary.ByteOrder
+		// routes is the routing table, as found in /proc/net/route.
+		routes    string
+		want      string
+		shouldErr bool
+	}{
+		{
+			name:  "little-endian host",
+			order: binary.LittleEndian,
+			routes: "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+				"eth0\t000200C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n" +
+				"eth1\t00000000\t00000000\t0001\t0\t0\t200\t00000000\t0\t0\t0\n" +
+				"eth0\t00000000\t010200C0\t0003\t0\t0\t100\t00000000\t0\t0\t0\n",
+			want: "192.0.2.1",
+		},
+		{
+			name:  "big-endian host",
+			order: binary.BigEndian,
+			routes: "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+				"eth0\tC0000200\t00000000\t0001\t0\t0\t0\tFFFFFF00\t0\t0\t0\n" +
+				"eth0\t00000000\tC0000201\t0003\t0\t0\t100\t00000000\t0\t0\t0\n",
+			want: "192.0.2.1",
+		},
+		{
+			name:  "default route not found",
+			order: binary.LittleEndian,
+			routes: "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+				"eth0\t000200C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n",
+			shouldErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "route")
+			if err := os.WriteFile(path, []byte(tc.routes), 0600); err != nil {
+				t.Fatal(err)
+			}
+			ip, err := readDefaultGateway(path, tc.order)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", ip)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if ip.String() != tc.want {
+				t.Fatalf("unexpected gateway: %s (actual) vs. %s (expected)", ip, tc.want)
+			}
+		})
+	}
+}
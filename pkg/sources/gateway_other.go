@@ -0,0 +1,14 @@
+//go:build !linux
+
+package sources
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// defaultGateway is not supported on this platform. It always returns error.
+func defaultGateway() (net.IP, error) {
+	return nil, fmt.Errorf("default gateway discovery is not supported on %s", runtime.GOOS)
+}
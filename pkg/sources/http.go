@@ -0,0 +1,211 @@
+package sources
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/utils"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const defaultUserAgent = "greenpau-dyndns/1.0 (+https://github.com/greenpau/dyndns)"
+
+// maxResponseSize is the maximum size of the response body read from
+// HTTP sources.
+const maxResponseSize = 1 << 20
+
+func init() {
+	RegisterFactory("http", func() Source {
+		return &HTTPSource{}
+	})
+}
+
+// HTTPSource is an HTTP echo service responding with the address of the
+// client, e.g. https://checkip.amazonaws.com/. The requests are sent over
+// IPv4 or IPv6 depending on the requested IP version.
+//
+// By default, the response body must be the address. When the service
+// responds with JSON or HTML, e.g. a router status page, the address is
+// extracted with either a JSON path or a regular expression.
+type HTTPSource struct {
+	Source    string            `json:"type" yaml:"type"`
+	URL       string            `json:"url" yaml:"url"`
+	UserAgent string            `json:"user_agent,omitempty" yaml:"user_agent,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Username  string            `json:"username,omitempty" yaml:"username,omitempty"`
+	Password  string            `json:"password,omitempty" yaml:"password,omitempty"`
+	JSONPath  string            `json:"json_path,omitempty" yaml:"json_path,omitempty"`
+	Regex     string            `json:"regex,omitempty" yaml:"regex,omitempty"`
+	Versions  []int             `json:"versions,omitempty" yaml:"versions,omitempty"`
+	log       *zap.Logger
+	jsonPath  []jsonPathStep
+	regex     *regexp.Regexp
+}
+
+// NewHTTPSource returns an instance of HTTPSource for the provided URL
+// and IP versions.
+func NewHTTPSource(url string, versions ...int) *HTTPSource {
+	return &HTTPSource{
+		Source:   "http",
+		URL:      url,
+		Versions: versions,
+	}
+}
+
+// sensitiveHeaderNames are the parts of the header names carrying secrets,
+// e.g. Authorization, X-Api-Key, or X-Auth-Token.
+var sensitiveHeaderNames = []string{"auth", "key", "token", "secret", "password", "cookie", "session", "credential"}
+
+// isSensitiveHeader returns true when the value of the provided header
+// is a secret.
+func isSensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitiveHeaderNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON packs configuration of HTTPSource with the password and the
+// values of sensitive headers masked.
+func (s HTTPSource) MarshalJSON() ([]byte, error) {
+	type config HTTPSource
+	c := config(s)
+	c.Password = utils.MaskSecret(c.Password, 2, 2)
+	if len(s.Headers) > 0 {
+		c.Headers = make(map[string]string, len(s.Headers))
+		for k, v := range s.Headers {
+			if isSensitiveHeader(k) {
+				v = utils.MaskSecret(v, 2, 2)
+			}
+			c.Headers[k] = v
+		}
+	}
+	return json.Marshal(c)
+}
+
+// Validate validates an instance of *HTTPSource.
+func (s *HTTPSource) Validate() error {
+	if s.URL == "" {
+		return fmt.Errorf("source requires a url")
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %s", s.URL)
+	}
+	if s.Password != "" && s.Username == "" {
+		return fmt.Errorf("source requires a username when a password is set")
+	}
+	for k := range s.Headers {
+		if k == "" || strings.ContainsAny(k, " :\r\n") {
+			return fmt.Errorf("invalid header name %q", k)
+		}
+	}
+	if s.JSONPath != "" && s.Regex != "" {
+		return fmt.Errorf("source supports either json_path or regex, not both")
+	}
+	if s.JSONPath != "" {
+		path, err := parseJSONPath(s.JSONPath)
+		if err != nil {
+			return err
+		}
+		s.jsonPath = path
+	}
+	if s.Regex != "" {
+		re, err := regexp.Compile(s.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression %s: %s", s.Regex, err)
+		}
+		if re.NumSubexp() > 1 {
+			return fmt.Errorf("invalid regular expression %s, it must have at most one capture group", s.Regex)
+		}
+		s.regex = re
+	}
+	if err := validateVersions(s.Versions); err != nil {
+		return err
+	}
+	if s.Source != "http" {
+		return fmt.Errorf("source mismatch: %s (config) vs. http (expected)", s.Source)
+	}
+	return nil
+}
+
+// Configure configures an instance of *HTTPSource.
+func (s *HTTPSource) Configure(logger *zap.Logger) error {
+	s.log = logger
+	if s.UserAgent == "" {
+		s.UserAgent = defaultUserAgent
+	}
+	return s.Validate()
+}
+
+// GetSource returns the source type of HTTPSource.
+func (s *HTTPSource) GetSource() string {
+	return s.Source
+}
+
+// GetVersions returns the IP versions of the addresses provided by HTTPSource.
+func (s *HTTPSource) GetVersions() []int {
+	return getVersions(s.Versions)
+}
+
+// GetAddress returns the address of the provided IP version reported by
+// the echo service.
+func (s *HTTPSource) GetAddress(version int) (string, error) {
+	if !supportsVersion(s.Versions, version) {
+		return "", ErrVersionNotSupported
+	}
+	body, err := s.get(version)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case s.jsonPath != nil:
+		return extractJSONPath(body, s.jsonPath, version)
+	case s.regex != nil:
+		return extractRegex(body, s.regex, version)
+	}
+	return utils.ParseAddress(strings.TrimSpace(string(body)), version)
+}
+
+// get sends a request to the URL of the source over the network of the
+// provided IP version and returns the response body.
+func (s *HTTPSource) get(version int) ([]byte, error) {
+	browser, err := utils.NewBrowserForVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", s.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating http get: %s", err)
+	}
+	req.Header.Set("User-Agent", s.UserAgent)
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+
+	resp, err := browser.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http request error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http request to %s failed with status code %d", s.URL, resp.StatusCode)
+	}
+	return body, nil
+}
@@ -0,0 +1,132 @@
+package sources
+
+import (
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/utils"
+	"go.uber.org/zap"
+	"net"
+)
+
+// The flags of IPv6 addresses, see if_addr.h.
+const (
+	ifaFlagTemporary  = 0x01
+	ifaFlagDADFailed  = 0x08
+	ifaFlagDeprecated = 0x20
+	ifaFlagTentative  = 0x40
+	ifaFlagPermanent  = 0x80
+)
+
+var cgnatNetwork = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+func init() {
+	RegisterFactory("interface", func() Source {
+		return &InterfaceSource{}
+	})
+}
+
+// InterfaceSource is a local network interface holding the public address,
+// e.g. on a VPS or on a host with SLAAC assigned IPv6 address. Loopback,
+// link-local, and multicast addresses are always skipped. Private (RFC 1918,
+// CGNAT, and ULA) addresses are skipped unless allowed. On Linux, temporary
+// (privacy), deprecated, and tentative IPv6 addresses are skipped unless
+// allowed, and permanent addresses are preferred.
+type InterfaceSource struct {
+	Source         string `json:"type" yaml:"type"`
+	Interface      string `json:"interface" yaml:"interface"`
+	AllowPrivate   bool   `json:"allow_private,omitempty" yaml:"allow_private,omitempty"`
+	AllowTemporary bool   `json:"allow_temporary,omitempty" yaml:"allow_temporary,omitempty"`
+	Versions       []int  `json:"versions,omitempty" yaml:"versions,omitempty"`
+	log            *zap.Logger
+}
+
+// Validate validates an instance of *InterfaceSource.
+func (s *InterfaceSource) Validate() error {
+	if s.Interface == "" {
+		return fmt.Errorf("source requires an interface name")
+	}
+	if err := validateVersions(s.Versions); err != nil {
+		return err
+	}
+	if s.Source != "interface" {
+		return fmt.Errorf("source mismatch: %s (config) vs. interface (expected)", s.Source)
+	}
+	return nil
+}
+
+// Configure configures an instance of *InterfaceSource.
+func (s *InterfaceSource) Configure(logger *zap.Logger) error {
+	s.log = logger
+	return s.Validate()
+}
+
+// GetSource returns the source type of InterfaceSource.
+func (s *InterfaceSource) GetSource() string {
+	return s.Source
+}
+
+// GetVersions returns the IP versions of the addresses provided by InterfaceSource.
+func (s *InterfaceSource) GetVersions() []int {
+	return getVersions(s.Versions)
+}
+
+// GetAddress returns the address of the provided IP version assigned to
+// the interface.
+func (s *InterfaceSource) GetAddress(version int) (string, error) {
+	if !supportsVersion(s.Versions, version) {
+		return "", ErrVersionNotSupported
+	}
+	iface, err := net.InterfaceByName(s.Interface)
+	if err != nil {
+		return "", fmt.Errorf("interface %s not found: %s", s.Interface, err)
+	}
+	ifaceAddrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("failed getting addresses of interface %s: %s", s.Interface, err)
+	}
+	addrs := []net.IP{}
+	for _, ifaceAddr := range ifaceAddrs {
+		if ipnet, ok := ifaceAddr.(*net.IPNet); ok {
+			addrs = append(addrs, ipnet.IP)
+		}
+	}
+	addr, err := s.selectAddress(addrs, readAddressFlags(), version)
+	if err != nil {
+		return "", fmt.Errorf("interface %s: %s", s.Interface, err)
+	}
+	return addr, nil
+}
+
+// selectAddress returns the preferred address of the provided IP version.
+// The flags are the flags of IPv6 addresses keyed by address.
+func (s *InterfaceSource) selectAddress(addrs []net.IP, flags map[string]uint32, version int) (string, error) {
+	var selected net.IP
+	var selectedPermanent bool
+	for _, ip := range addrs {
+		if utils.MatchAddressVersion(ip, version) != nil {
+			continue
+		}
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+			ip.IsMulticast() || ip.IsUnspecified() {
+			continue
+		}
+		if !s.AllowPrivate && (ip.IsPrivate() || cgnatNetwork.Contains(ip)) {
+			continue
+		}
+		f := flags[ip.String()]
+		if f&(ifaFlagDADFailed|ifaFlagTentative) != 0 {
+			continue
+		}
+		if !s.AllowTemporary && f&(ifaFlagTemporary|ifaFlagDeprecated) != 0 {
+			continue
+		}
+		permanent := f&ifaFlagPermanent != 0
+		if selected == nil || (permanent && !selectedPermanent) {
+			selected = ip
+			selectedPermanent = permanent
+		}
+	}
+	if selected == nil {
+		return "", fmt.Errorf("no suitable ip version %d address found", version)
+	}
+	return selected.String(), nil
+}
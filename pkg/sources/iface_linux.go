@@ -0,0 +1,42 @@
+//go:build linux
+
+package sources
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readAddressFlags returns the flags of IPv6 addresses keyed by address,
+// read from /proc/net/if_inet6.
+func readAddressFlags() map[string]uint32 {
+	flags := make(map[string]uint32)
+	f, err := os.Open("/proc/net/if_inet6")
+	if err != nil {
+		return flags
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The fields are address, interface index, prefix length, scope,
+		// flags, and interface name.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		b, err := hex.DecodeString(fields[0])
+		if err != nil || len(b) != net.IPv6len {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[4], 16, 32)
+		if err != nil {
+			continue
+		}
+		flags[net.IP(b).String()] = uint32(v)
+	}
+	return flags
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package sources
+
+// readAddressFlags returns no flags, because the flags of IPv6 addresses
+// are not available on this platform.
+func readAddressFlags() map[string]uint32 {
+	return map[string]uint32{}
+}
@@ -0,0 +1,74 @@
+package sources
+
+import (
+	"net"
+	"testing"
+)
+
+func TestInterfaceSourceSelectAddress(t *testing.T) {
+	addrs := []net.IP{
+		net.ParseIP("127.0.0.1"),
+		net.ParseIP("10.0.0.5"),
+		net.ParseIP("100.64.1.5"),
+		net.ParseIP("203.0.113.10"),
+		net.ParseIP("fe80::1"),
+		net.ParseIP("fd00::5"),
+		net.ParseIP("2001:db8::aaaa"),
+		net.ParseIP("2001:db8::bbbb"),
+		net.ParseIP("2001:db8::cccc"),
+	}
+	flags := map[string]uint32{
+		"2001:db8::aaaa": ifaFlagTemporary,
+		"2001:db8::bbbb": 0,
+		"2001:db8::cccc": ifaFlagPermanent,
+	}
+	testcases := []struct {
+		name      string
+		source    *InterfaceSource
+		addrs     []net.IP
+		flags     map[string]uint32
+		version   int
+		want      string
+		shouldErr bool
+	}{
+		{name: "public ipv4 address", source: &InterfaceSource{}, addrs: addrs, version: 4, want: "203.0.113.10"},
+		{name: "private ipv4 address", source: &InterfaceSource{AllowPrivate: true}, addrs: addrs, version: 4, want: "10.0.0.5"},
+		{name: "no public ipv4 address", source: &InterfaceSource{}, addrs: addrs[:3], version: 4, shouldErr: true},
+		{name: "permanent ipv6 address", source: &InterfaceSource{}, addrs: addrs, flags: flags, version: 6, want: "2001:db8::cccc"},
+		{name: "stable ipv6 address", source: &InterfaceSource{}, addrs: addrs[:8], flags: flags, version: 6, want: "2001:db8::bbbb"},
+		{name: "temporary ipv6 address", source: &InterfaceSource{AllowTemporary: true}, addrs: addrs[:8], flags: flags, version: 6, want: "2001:db8::aaaa"},
+		{name: "ula ipv6 address", source: &InterfaceSource{AllowPrivate: true}, addrs: addrs[:6], version: 6, want: "fd00::5"},
+		{name: "no ipv6 address", source: &InterfaceSource{}, addrs: addrs[:7], flags: flags, version: 6, shouldErr: true},
+		{name: "deprecated ipv6 address", source: &InterfaceSource{}, addrs: addrs[7:8], flags: map[string]uint32{"2001:db8::bbbb": ifaFlagDeprecated}, version: 6, shouldErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.source.selectAddress(tc.addrs, tc.flags, tc.version)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Fatalf("unexpected address: %s (actual) vs. %s (expected)", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInterfaceSourceLoopback(t *testing.T) {
+	s := &InterfaceSource{Source: "interface", Interface: "lo"}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := net.InterfaceByName("lo"); err != nil {
+		t.Skipf("loopback interface not found: %s", err)
+	}
+	if addr, err := s.GetAddress(4); err == nil {
+		t.Fatalf("expected loopback address to be skipped, got %s", addr)
+	}
+}
@@ -0,0 +1,244 @@
+package sources
+
+import (
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/utils"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// awsTokenTTL is the lifetime of IMDSv2 session tokens, in seconds.
+	awsTokenTTL = 21600
+	// awsTokenRefresh is the time before the expiry of an IMDSv2 session
+	// token when a new token is requested.
+	awsTokenRefresh = time.Minute
+)
+
+func init() {
+	RegisterFactory("metadata", func() Source {
+		return &MetadataSource{}
+	})
+}
+
+// metadataPlatform is the instance metadata service of a cloud platform.
+type metadataPlatform struct {
+	endpoint string
+	paths    map[int]string
+	headers  map[string]string
+}
+
+var metadataPlatforms = map[string]metadataPlatform{
+	"aws": {
+		endpoint: "http://169.254.169.254",
+		paths: map[int]string{
+			4: "/latest/meta-data/public-ipv4",
+			6: "/latest/meta-data/ipv6",
+		},
+	},
+	"gcp": {
+		endpoint: "http://metadata.google.internal",
+		paths: map[int]string{
+			4: "/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip",
+			6: "/computeMetadata/v1/instance/network-interfaces/0/ipv6-access-configs/0/external-ipv6",
+		},
+		headers: map[string]string{"Metadata-Flavor": "Google"},
+	},
+	"azure": {
+		endpoint: "http://169.254.169.254",
+		paths: map[int]string{
+			4: "/metadata/instance/network/interface/0/ipv4/ipAddress/0/publicIpAddress?api-version=2021-02-01&format=text",
+			6: "/metadata/instance/network/interface/0/ipv6/ipAddress/0/publicIpAddress?api-version=2021-02-01&format=text",
+		},
+		headers: map[string]string{"Metadata": "true"},
+	},
+}
+
+// MetadataSource is the instance metadata service of a cloud platform,
+// i.e. aws, gcp, or azure, reporting the public address of the instance.
+// On AWS, the requests are authenticated with IMDSv2 session tokens. The
+// endpoint overrides the address of the metadata service.
+type MetadataSource struct {
+	Source   string `json:"type" yaml:"type"`
+	Platform string `json:"platform" yaml:"platform"`
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	Timeout  uint64 `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Versions []int  `json:"versions,omitempty" yaml:"versions,omitempty"`
+	log      *zap.Logger
+	client   *http.Client
+	mu       sync.Mutex
+	token    string
+	expires  time.Time
+}
+
+// Validate validates an instance of *MetadataSource.
+func (s *MetadataSource) Validate() error {
+	if _, exists := metadataPlatforms[s.Platform]; !exists {
+		return fmt.Errorf("unsupported platform %q, must be one of the following: aws, gcp, azure", s.Platform)
+	}
+	if s.Endpoint != "" {
+		u, err := url.Parse(s.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid endpoint %s", s.Endpoint)
+		}
+	}
+	if err := validateVersions(s.Versions); err != nil {
+		return err
+	}
+	if s.Source != "metadata" {
+		return fmt.Errorf("source mismatch: %s (config) vs. metadata (expected)", s.Source)
+	}
+	return nil
+}
+
+// Configure configures an instance of *MetadataSource.
+func (s *MetadataSource) Configure(logger *zap.Logger) error {
+	s.log = logger
+	if s.Timeout == 0 {
+		s.Timeout = 2
+	}
+	// The metadata service is reachable from the instance only, and the
+	// requests must not go through a proxy.
+	s.client = &http.Client{
+		Timeout:   time.Duration(s.Timeout) * time.Second,
+		Transport: &http.Transport{Proxy: nil},
+	}
+	return s.Validate()
+}
+
+// GetSource returns the source type of MetadataSource.
+func (s *MetadataSource) GetSource() string {
+	return s.Source
+}
+
+// GetVersions returns the IP versions of the addresses provided by
+// MetadataSource, limited to the addresses exposed by the platform.
+func (s *MetadataSource) GetVersions() []int {
+	versions := []int{}
+	for _, version := range getVersions(s.Versions) {
+		if _, exists := metadataPlatforms[s.Platform].paths[version]; exists {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+// GetAddress returns the public address of the provided IP version
+// assigned to the instance.
+func (s *MetadataSource) GetAddress(version int) (string, error) {
+	if !supportsVersion(s.Versions, version) {
+		return "", ErrVersionNotSupported
+	}
+	platform := metadataPlatforms[s.Platform]
+	path, exists := platform.paths[version]
+	if !exists {
+		return "", ErrVersionNotSupported
+	}
+
+	resp, body, err := s.get(platform, path)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && s.Platform == "aws" {
+		// The session token expired or the instance was restarted.
+		s.resetToken()
+		resp, body, err = s.get(platform, path)
+	}
+	if err != nil {
+		return "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("%s instance has no public ipv%d address", s.Platform, version)
+	default:
+		return "", fmt.Errorf("%s metadata request failed with status code %d", s.Platform, resp.StatusCode)
+	}
+
+	// The AWS IPv6 addresses are newline separated.
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%s instance has no public ipv%d address", s.Platform, version)
+	}
+	return utils.ParseAddress(fields[0], version)
+}
+
+// get sends a metadata request for the provided path.
+func (s *MetadataSource) get(platform metadataPlatform, path string) (*http.Response, []byte, error) {
+	req, err := http.NewRequest("GET", s.getEndpoint(platform)+path, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating metadata request: %s", err)
+	}
+	for k, v := range platform.headers {
+		req.Header.Set(k, v)
+	}
+	if s.Platform == "aws" {
+		token, err := s.getToken(platform)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s metadata request error: %s", s.Platform, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading metadata response body: %s", err)
+	}
+	return resp, body, nil
+}
+
+// getToken returns IMDSv2 session token, requesting a new token when the
+// cached one is about to expire.
+func (s *MetadataSource) getToken(platform metadataPlatform) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expires.Add(-awsTokenRefresh)) {
+		return s.token, nil
+	}
+
+	req, err := http.NewRequest("PUT", s.getEndpoint(platform)+"/latest/api/token", nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating metadata token request: %s", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", fmt.Sprintf("%d", awsTokenTTL))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("aws metadata token request error: %s", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("error reading metadata token response body: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("aws metadata token request failed with status code %d", resp.StatusCode)
+	}
+	token := strings.TrimSpace(string(body))
+	if token == "" {
+		return "", fmt.Errorf("aws metadata token request returned empty token")
+	}
+	s.token = token
+	s.expires = time.Now().Add(awsTokenTTL * time.Second)
+	return s.token, nil
+}
+
+// resetToken discards the cached IMDSv2 session token.
+func (s *MetadataSource) resetToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = ""
+}
+
+// getEndpoint returns the address of the metadata service.
+func (s *MetadataSource) getEndpoint(platform metadataPlatform) string {
+	if s.Endpoint != "" {
+		return strings.TrimSuffix(s.Endpoint, "/")
+	}
+	return platform.endpoint
+}
@@ -0,0 +1,142 @@
+package sources
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// metadataServer is a stand-in for the instance metadata services.
+type metadataServer struct {
+	mu     sync.Mutex
+	token  string
+	tokens int
+}
+
+func (m *metadataServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case r.URL.Path == "/latest/api/token":
+		if r.Method != http.MethodPut || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.tokens++
+		m.token = fmt.Sprintf("token-%d", m.tokens)
+		fmt.Fprint(w, m.token)
+	case strings.HasPrefix(r.URL.Path, "/latest/meta-data/"):
+		if r.Header.Get("X-aws-ec2-metadata-token") != m.token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/public-ipv4":
+			fmt.Fprint(w, "203.0.113.10")
+		case "/latest/meta-data/ipv6":
+			fmt.Fprint(w, "2001:db8::10\n2001:db8::11")
+		default:
+			http.NotFound(w, r)
+		}
+	case strings.HasPrefix(r.URL.Path, "/computeMetadata/v1/"):
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/access-configs/0/external-ip") {
+			fmt.Fprint(w, "203.0.113.20")
+			return
+		}
+		http.NotFound(w, r)
+	case strings.HasPrefix(r.URL.Path, "/metadata/instance/"):
+		if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("api-version") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if strings.Contains(r.URL.Path, "/ipv4/") {
+			fmt.Fprint(w, "203.0.113.30")
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestMetadataSource(t *testing.T) {
+	srv := httptest.NewServer(&metadataServer{})
+	defer srv.Close()
+
+	testcases := []struct {
+		name      string
+		platform  string
+		version   int
+		want      string
+		shouldErr bool
+	}{
+		{name: "aws ipv4 address", platform: "aws", version: 4, want: "203.0.113.10"},
+		{name: "aws ipv6 address", platform: "aws", version: 6, want: "2001:db8::10"},
+		{name: "gcp ipv4 address", platform: "gcp", version: 4, want: "203.0.113.20"},
+		{name: "gcp without ipv6 address", platform: "gcp", version: 6, shouldErr: true},
+		{name: "azure ipv4 address", platform: "azure", version: 4, want: "203.0.113.30"},
+		{name: "azure without ipv6 address", platform: "azure", version: 6, shouldErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &MetadataSource{Source: "metadata", Platform: tc.platform, Endpoint: srv.URL}
+			if err := s.Configure(zap.NewNop()); err != nil {
+				t.Fatalf("unexpected configuration error: %s", err)
+			}
+			addr, err := s.GetAddress(tc.version)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if addr != tc.want {
+				t.Fatalf("unexpected address: %s (actual) vs. %s (expected)", addr, tc.want)
+			}
+		})
+	}
+}
+
+func TestMetadataSourceToken(t *testing.T) {
+	m := &metadataServer{}
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	s := &MetadataSource{Source: "metadata", Platform: "aws", Endpoint: srv.URL}
+	if err := s.Configure(zap.NewNop()); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := s.GetAddress(4); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if m.tokens != 1 {
+		t.Fatalf("expected the session token to be reused, got %d token requests", m.tokens)
+	}
+
+	// The session token is invalidated, e.g. after the instance restart.
+	m.mu.Lock()
+	m.token = "expired"
+	m.mu.Unlock()
+	addr, err := s.GetAddress(4)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if addr != "203.0.113.10" {
+		t.Fatalf("unexpected address: %s", addr)
+	}
+	if m.tokens != 2 {
+		t.Fatalf("expected a new session token, got %d token requests", m.tokens)
+	}
+}
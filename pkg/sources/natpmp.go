@@ -0,0 +1,248 @@
+package sources
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"go.uber.org/zap"
+	"net"
+	"time"
+)
+
+const (
+	natpmpPort = "5351"
+	// natpmpAttempts is the number of requests sent before giving up. The
+	// first request waits 250ms for a response, and the wait doubles with
+	// each retransmission.
+	natpmpAttempts = 4
+)
+
+// The result codes of NAT-PMP and PCP responses.
+var natpmpResultCodes = map[int]string{
+	1: "unsupported version",
+	2: "not authorized",
+	3: "network failure",
+	4: "out of resources",
+	5: "unsupported opcode",
+}
+
+var pcpResultCodes = map[int]string{
+	1:  "unsupported version",
+	2:  "not authorized",
+	3:  "malformed request",
+	4:  "unsupported opcode",
+	5:  "unsupported option",
+	6:  "malformed option",
+	7:  "network failure",
+	8:  "no resources",
+	9:  "unsupported protocol",
+	10: "user exceeded quota",
+	11: "cannot provide external address",
+	12: "address mismatch",
+	13: "excessive remote peers",
+}
+
+func init() {
+	RegisterFactory("natpmp", func() Source {
+		return &NATPMPSource{Source: "natpmp"}
+	})
+	RegisterFactory("pcp", func() Source {
+		return &NATPMPSource{Source: "pcp"}
+	})
+}
+
+// NATPMPSource is a router supporting NAT Port Mapping Protocol (RFC 6886),
+// or Port Control Protocol (RFC 6887). The gateway defaults to the default
+// gateway of the host on Linux. With NAT-PMP, the external address is
+// obtained with the external address request. With PCP, it is the address
+// assigned to a short-lived mapping, which is deleted right away.
+type NATPMPSource struct {
+	Source  string `json:"type" yaml:"type"`
+	Gateway string `json:"gateway,omitempty" yaml:"gateway,omitempty"`
+	log     *zap.Logger
+}
+
+// Validate validates an instance of *NATPMPSource.
+func (s *NATPMPSource) Validate() error {
+	if s.Gateway != "" {
+		if _, err := s.getGateway(); err != nil {
+			return err
+		}
+	}
+	if s.Source != "natpmp" && s.Source != "pcp" {
+		return fmt.Errorf("source mismatch: %s (config) vs. natpmp or pcp (expected)", s.Source)
+	}
+	return nil
+}
+
+// Configure configures an instance of *NATPMPSource.
+func (s *NATPMPSource) Configure(logger *zap.Logger) error {
+	s.log = logger
+	return s.Validate()
+}
+
+// GetSource returns the source type of NATPMPSource.
+func (s *NATPMPSource) GetSource() string {
+	return s.Source
+}
+
+// GetVersions returns the IP versions of the addresses provided by
+// NATPMPSource. NAT-PMP supports IPv4 only. PCP provides IPv6 addresses
+// with an IPv6 gateway only, and the default gateway is an IPv4 one.
+func (s *NATPMPSource) GetVersions() []int {
+	if s.Source != "pcp" || s.Gateway == "" {
+		return []int{4}
+	}
+	gateway, err := s.getGateway()
+	if err != nil {
+		return []int{4}
+	}
+	host, _, _ := net.SplitHostPort(gateway)
+	if net.ParseIP(host).To4() != nil {
+		return []int{4}
+	}
+	return []int{4, 6}
+}
+
+// getGateway returns the address of the gateway with port.
+func (s *NATPMPSource) getGateway() (string, error) {
+	gateway := s.Gateway
+	if gateway == "" {
+		ip, err := defaultGateway()
+		if err != nil {
+			return "", fmt.Errorf("gateway not configured and default gateway not found: %s", err)
+		}
+		return net.JoinHostPort(ip.String(), natpmpPort), nil
+	}
+	if _, _, err := net.SplitHostPort(gateway); err != nil {
+		gateway = net.JoinHostPort(gateway, natpmpPort)
+	}
+	host, _, _ := net.SplitHostPort(gateway)
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("invalid gateway %s, must be an ip address", s.Gateway)
+	}
+	return gateway, nil
+}
+
+// GetAddress returns the external address of the gateway.
+func (s *NATPMPSource) GetAddress(version int) (string, error) {
+	if !supportsVersion(s.GetVersions(), version) {
+		return "", ErrVersionNotSupported
+	}
+	gateway, err := s.getGateway()
+	if err != nil {
+		return "", err
+	}
+	conn, err := net.Dial("udp", gateway)
+	if err != nil {
+		return "", fmt.Errorf("failed connecting to gateway %s: %s", gateway, err)
+	}
+	defer conn.Close()
+
+	var ip net.IP
+	if s.Source == "pcp" {
+		ip, err = pcpExternalAddress(conn)
+	} else {
+		ip, err = natpmpExternalAddress(conn)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s request to gateway %s failed: %s", s.Source, gateway, err)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsUnspecified() {
+		return "", fmt.Errorf("gateway %s has no external address", gateway)
+	}
+	addr := ip.String()
+	if version == 6 && ip.To4() != nil || version == 4 && ip.To4() == nil {
+		return "", fmt.Errorf("gateway %s external address %s is not ip version %d", gateway, addr, version)
+	}
+	return addr, nil
+}
+
+// exchange sends the request and returns the first response accepted by
+// the match function, retransmitting the request as needed.
+func exchange(conn net.Conn, req []byte, match func([]byte) bool) ([]byte, error) {
+	buf := make([]byte, 1100)
+	timeout := 250 * time.Millisecond
+	for i := 0; i < natpmpAttempts; i++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(timeout)
+		conn.SetReadDeadline(deadline)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			if match(buf[:n]) {
+				return buf[:n], nil
+			}
+		}
+		timeout *= 2
+	}
+	return nil, fmt.Errorf("no response after %d attempts", natpmpAttempts)
+}
+
+// natpmpExternalAddress sends NAT-PMP external address request.
+func natpmpExternalAddress(conn net.Conn) (net.IP, error) {
+	resp, err := exchange(conn, []byte{0, 0}, func(b []byte) bool {
+		return len(b) >= 12 && b[0] == 0 && b[1] == 128
+	})
+	if err != nil {
+		return nil, err
+	}
+	if code := int(binary.BigEndian.Uint16(resp[2:4])); code != 0 {
+		return nil, fmt.Errorf("result code %d: %s", code, natpmpResultCodes[code])
+	}
+	return net.IPv4(resp[8], resp[9], resp[10], resp[11]), nil
+}
+
+// pcpExternalAddress sends PCP MAP request for a mapping of the local UDP
+// port and returns the assigned external address. The mapping is deleted
+// afterwards.
+func pcpExternalAddress(conn net.Conn) (net.IP, error) {
+	local := conn.LocalAddr().(*net.UDPAddr)
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	newRequest := func(lifetime uint32) []byte {
+		req := make([]byte, 60)
+		req[0] = 2 // version
+		req[1] = 1 // MAP opcode
+		binary.BigEndian.PutUint32(req[4:8], lifetime)
+		copy(req[8:24], local.IP.To16())
+		copy(req[24:36], nonce)
+		req[36] = 17 // UDP
+		binary.BigEndian.PutUint16(req[40:42], uint16(local.Port))
+		if local.IP.To4() != nil {
+			// The IPv4-mapped unspecified address means no preference.
+			copy(req[44:60], net.IPv4zero.To16())
+		}
+		return req
+	}
+	match := func(b []byte) bool {
+		return len(b) >= 60 && b[0] == 2 && b[1] == 0x81 && bytes.Equal(b[24:36], nonce)
+	}
+
+	resp, err := exchange(conn, newRequest(30), match)
+	if err != nil {
+		return nil, err
+	}
+	if code := int(resp[3]); code != 0 {
+		return nil, fmt.Errorf("result code %d: %s", code, pcpResultCodes[code])
+	}
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, resp[44:60])
+
+	// Delete the mapping, the failure is not relevant to the result.
+	exchange(conn, newRequest(0), match)
+	return ip, nil
+}
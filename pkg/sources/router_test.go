@@ -0,0 +1,187 @@
+package sources
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+const testDeviceDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+const testExternalIPAddressResponse = `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+  <s:Body>
+    <u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+      <NewExternalIPAddress>%s</NewExternalIPAddress>
+    </u:GetExternalIPAddressResponse>
+  </s:Body>
+</s:Envelope>`
+
+func TestUPnPSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rootDesc.xml":
+			fmt.Fprint(w, testDeviceDescription)
+		case "/ctl/IPConn":
+			body, _ := io.ReadAll(r.Body)
+			if r.Method != http.MethodPost ||
+				r.Header.Get("SOAPAction") != `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"` ||
+				!strings.Contains(string(body), "GetExternalIPAddress") {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintf(w, testExternalIPAddressResponse, "203.0.113.10")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	s := &UPnPSource{Source: "upnp", Location: srv.URL + "/rootDesc.xml"}
+	if err := s.Configure(zap.NewNop()); err != nil {
+		t.Fatalf("unexpected configuration error: %s", err)
+	}
+	addr, err := s.GetAddress(4)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if addr != "203.0.113.10" {
+		t.Fatalf("unexpected address: %s", addr)
+	}
+	if s.controlURL != srv.URL+"/ctl/IPConn" {
+		t.Fatalf("unexpected control url: %s", s.controlURL)
+	}
+	if _, err := s.GetAddress(6); err != ErrVersionNotSupported {
+		t.Fatalf("expected ip version 6 to be unsupported, got %v", err)
+	}
+}
+
+// startGateway starts a fake NAT-PMP and PCP gateway responding with the
+// provided external address and result code.
+func startGateway(t *testing.T, external net.IP, code int) string {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1100)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := buf[:n]
+			var resp []byte
+			switch {
+			case n == 2 && req[0] == 0 && req[1] == 0:
+				// NAT-PMP external address request
+				resp = make([]byte, 12)
+				resp[1] = 128
+				binary.BigEndian.PutUint16(resp[2:4], uint16(code))
+				copy(resp[8:12], external.To4())
+			case n == 60 && req[0] == 2 && req[1] == 1:
+				// PCP MAP request
+				resp = make([]byte, 60)
+				resp[0] = 2
+				resp[1] = 0x81
+				resp[3] = byte(code)
+				copy(resp[8:12], req[4:8])
+				copy(resp[24:44], req[24:44])
+				copy(resp[44:60], external.To16())
+			default:
+				continue
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestNATPMPSourceVersions(t *testing.T) {
+	testcases := []struct {
+		name   string
+		source *NATPMPSource
+		want   []int
+	}{
+		{name: "natpmp", source: &NATPMPSource{Source: "natpmp", Gateway: "[2001:db8::1]:5351"}, want: []int{4}},
+		{name: "pcp with default gateway", source: &NATPMPSource{Source: "pcp"}, want: []int{4}},
+		{name: "pcp with ipv4 gateway", source: &NATPMPSource{Source: "pcp", Gateway: "192.168.1.1"}, want: []int{4}},
+		{name: "pcp with ipv6 gateway", source: &NATPMPSource{Source: "pcp", Gateway: "2001:db8::1"}, want: []int{4, 6}},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.source.GetVersions(); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("unexpected versions: %v (actual) vs. %v (expected)", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNATPMPSource(t *testing.T) {
+	testcases := []struct {
+		name      string
+		source    string
+		code      int
+		version   int
+		want      string
+		shouldErr bool
+	}{
+		{name: "natpmp", source: "natpmp", version: 4, want: "203.0.113.10"},
+		{name: "natpmp failure", source: "natpmp", code: 3, version: 4, shouldErr: true},
+		{name: "pcp", source: "pcp", version: 4, want: "203.0.113.10"},
+		{name: "pcp failure", source: "pcp", code: 11, version: 4, shouldErr: true},
+		{name: "pcp ipv6 request with ipv4 gateway", source: "pcp", version: 6, shouldErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := startGateway(t, net.ParseIP("203.0.113.10"), tc.code)
+			s := &NATPMPSource{Source: tc.source, Gateway: gateway}
+			if err := s.Configure(zap.NewNop()); err != nil {
+				t.Fatalf("unexpected configuration error: %s", err)
+			}
+			addr, err := s.GetAddress(tc.version)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if addr != tc.want {
+				t.Fatalf("unexpected address: %s (actual) vs. %s (expected)", addr, tc.want)
+			}
+		})
+	}
+}
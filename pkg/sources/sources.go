@@ -0,0 +1,83 @@
+// Package sources holds the public address sources and their registry.
+// Each source type registers a factory for its type name in init, and the
+// configuration decoder creates sources by the type name found in the
+// source configuration.
+package sources
+
+import (
+	"errors"
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/registry"
+	"go.uber.org/zap"
+)
+
+// ErrVersionNotSupported is returned by the sources not configured to
+// provide an address of the requested IP version.
+var ErrVersionNotSupported = errors.New("ip version is not supported by the source")
+
+// Source is the interface implemented by public address sources.
+// GetVersions returns the IP versions of the addresses provided by the
+// source.
+type Source interface {
+	Configure(*zap.Logger) error
+	Validate() error
+	GetSource() string
+	GetVersions() []int
+	GetAddress(int) (string, error)
+}
+
+// Factory returns a new, unconfigured instance of a Source.
+type Factory func() Source
+
+var factories = registry.New[Source]("sources", "source", "address source")
+
+// RegisterFactory makes an address source available under the provided
+// type name. It panics if the name is empty, the factory is nil, or the
+// name is already registered.
+func RegisterFactory(name string, factory Factory) {
+	factories.Register(name, factory)
+}
+
+// New returns a new instance of the source registered under the provided
+// type name.
+func New(name string) (Source, error) {
+	return factories.New(name)
+}
+
+// Names returns sorted type names of the registered address sources.
+func Names() []string {
+	return factories.Names()
+}
+
+// validateVersions validates the list of IP versions of a source.
+func validateVersions(versions []int) error {
+	for _, version := range versions {
+		if version != 4 && version != 6 {
+			return fmt.Errorf("invalid ip version %d", version)
+		}
+	}
+	return nil
+}
+
+// getVersions returns the list of IP versions of a source, or both IP
+// versions when the list is empty.
+func getVersions(versions []int) []int {
+	if len(versions) == 0 {
+		return []int{4, 6}
+	}
+	return versions
+}
+
+// supportsVersion returns true when the IP version is in the list of IP
+// versions of a source, or when the list is empty.
+func supportsVersion(versions []int, version int) bool {
+	if len(versions) == 0 {
+		return true
+	}
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
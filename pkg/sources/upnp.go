@@ -0,0 +1,289 @@
+package sources
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/utils"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ssdpAddress = "239.255.255.250:1900"
+
+// upnpServiceTypes are the UPnP services providing GetExternalIPAddress
+// action, in the order of preference.
+var upnpServiceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+func init() {
+	RegisterFactory("upnp", func() Source {
+		return &UPnPSource{}
+	})
+}
+
+// UPnPSource is a router supporting UPnP Internet Gateway Device protocol.
+// The external address is obtained with GetExternalIPAddress action. The
+// router is discovered with SSDP unless the location of its device
+// description is provided.
+type UPnPSource struct {
+	Source   string `json:"type" yaml:"type"`
+	Location string `json:"location,omitempty" yaml:"location,omitempty"`
+	Timeout  uint64 `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	log      *zap.Logger
+
+	mu          sync.Mutex
+	controlURL  string
+	serviceType string
+}
+
+type upnpDevice struct {
+	Services []upnpService `xml:"serviceList>service"`
+	Devices  []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+type upnpDescription struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+// findService returns the first service of the provided type.
+func (d *upnpDevice) findService(serviceType string) *upnpService {
+	for i := range d.Services {
+		if d.Services[i].ServiceType == serviceType {
+			return &d.Services[i]
+		}
+	}
+	for i := range d.Devices {
+		if svc := d.Devices[i].findService(serviceType); svc != nil {
+			return svc
+		}
+	}
+	return nil
+}
+
+// Validate validates an instance of *UPnPSource.
+func (s *UPnPSource) Validate() error {
+	if s.Location != "" {
+		u, err := url.Parse(s.Location)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid location %s", s.Location)
+		}
+	}
+	if s.Source != "upnp" {
+		return fmt.Errorf("source mismatch: %s (config) vs. upnp (expected)", s.Source)
+	}
+	return nil
+}
+
+// Configure configures an instance of *UPnPSource.
+func (s *UPnPSource) Configure(logger *zap.Logger) error {
+	s.log = logger
+	if s.Timeout == 0 {
+		s.Timeout = 3
+	}
+	return s.Validate()
+}
+
+// GetSource returns the source type of UPnPSource.
+func (s *UPnPSource) GetSource() string {
+	return s.Source
+}
+
+// GetVersions returns the IP versions of the addresses provided by
+// UPnPSource, i.e. IPv4 only.
+func (s *UPnPSource) GetVersions() []int {
+	return []int{4}
+}
+
+// GetAddress returns the external IPv4 address of the router.
+func (s *UPnPSource) GetAddress(version int) (string, error) {
+	if version != 4 {
+		return "", ErrVersionNotSupported
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.controlURL == "" {
+		if err := s.discover(); err != nil {
+			return "", err
+		}
+	}
+	addr, err := s.getExternalIPAddress()
+	if err != nil {
+		// The router might have restarted with different control URL.
+		s.controlURL = ""
+		return "", err
+	}
+	return addr, nil
+}
+
+// discover finds the control URL of the WAN connection service.
+func (s *UPnPSource) discover() error {
+	locations := []string{s.Location}
+	if s.Location == "" {
+		var err error
+		locations, err = s.search()
+		if err != nil {
+			return err
+		}
+	}
+	errs := []string{}
+	for _, location := range locations {
+		controlURL, serviceType, err := s.getControlURL(location)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		s.controlURL = controlURL
+		s.serviceType = serviceType
+		if s.log != nil {
+			s.log.Debug(
+				"found upnp internet gateway device",
+				zap.String("location", location),
+				zap.String("control_url", controlURL),
+				zap.String("service_type", serviceType),
+			)
+		}
+		return nil
+	}
+	return fmt.Errorf("upnp internet gateway device not found: %s", strings.Join(errs, "; "))
+}
+
+// search sends SSDP M-SEARCH requests and returns the locations of the
+// device descriptions of the responding internet gateway devices.
+func (s *UPnPSource) search() ([]string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("ssdp search failed: %s", err)
+	}
+	defer conn.Close()
+	dst, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		return nil, fmt.Errorf("ssdp search failed: %s", err)
+	}
+	for _, st := range []string{
+		"urn:schemas-upnp-org:device:InternetGatewayDevice:2",
+		"urn:schemas-upnp-org:device:InternetGatewayDevice:1",
+	} {
+		req := "M-SEARCH * HTTP/1.1\r\n" +
+			"HOST: " + ssdpAddress + "\r\n" +
+			"ST: " + st + "\r\n" +
+			"MAN: \"ssdp:discover\"\r\n" +
+			"MX: 2\r\n\r\n"
+		if _, err := conn.WriteTo([]byte(req), dst); err != nil {
+			return nil, fmt.Errorf("ssdp search failed: %s", err)
+		}
+	}
+
+	locations := []string{}
+	seen := make(map[string]bool)
+	conn.SetReadDeadline(time.Now().Add(time.Duration(s.Timeout) * time.Second))
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\r\n") {
+			k, v, found := strings.Cut(line, ":")
+			if !found || !strings.EqualFold(strings.TrimSpace(k), "location") {
+				continue
+			}
+			v = strings.TrimSpace(v)
+			if !seen[v] {
+				seen[v] = true
+				locations = append(locations, v)
+			}
+		}
+	}
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("ssdp search found no internet gateway devices")
+	}
+	return locations, nil
+}
+
+func (s *UPnPSource) newClient() *http.Client {
+	return &http.Client{Timeout: time.Duration(s.Timeout) * time.Second}
+}
+
+// getControlURL returns the control URL and the type of the WAN connection
+// service found in the device description.
+func (s *UPnPSource) getControlURL(location string) (string, string, error) {
+	resp, err := s.newClient().Get(location)
+	if err != nil {
+		return "", "", fmt.Errorf("failed fetching device description from %s: %s", location, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("failed fetching device description from %s: status code %d", location, resp.StatusCode)
+	}
+	desc := &upnpDescription{}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(desc); err != nil {
+		return "", "", fmt.Errorf("failed parsing device description from %s: %s", location, err)
+	}
+	base, err := url.Parse(location)
+	if err != nil {
+		return "", "", err
+	}
+	if desc.URLBase != "" {
+		if u, err := url.Parse(desc.URLBase); err == nil {
+			base = u
+		}
+	}
+	for _, serviceType := range upnpServiceTypes {
+		svc := desc.Device.findService(serviceType)
+		if svc == nil {
+			continue
+		}
+		u, err := base.Parse(strings.TrimSpace(svc.ControlURL))
+		if err != nil {
+			return "", "", fmt.Errorf("invalid control url %s: %s", svc.ControlURL, err)
+		}
+		return u.String(), serviceType, nil
+	}
+	return "", "", fmt.Errorf("device at %s has no wan connection service", location)
+}
+
+// getExternalIPAddress calls GetExternalIPAddress action of the WAN
+// connection service.
+func (s *UPnPSource) getExternalIPAddress() (string, error) {
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:GetExternalIPAddress xmlns:u="` + s.serviceType + `"></u:GetExternalIPAddress></s:Body>` +
+		`</s:Envelope>`
+	req, err := http.NewRequest(http.MethodPost, s.controlURL, bytes.NewBufferString(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+s.serviceType+`#GetExternalIPAddress"`)
+	resp, err := s.newClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("upnp GetExternalIPAddress request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upnp GetExternalIPAddress request failed: status code %d", resp.StatusCode)
+	}
+	envelope := &struct {
+		Address string `xml:"Body>GetExternalIPAddressResponse>NewExternalIPAddress"`
+	}{}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(envelope); err != nil {
+		return "", fmt.Errorf("failed parsing upnp GetExternalIPAddress response: %s", err)
+	}
+	return utils.ParseAddress(strings.TrimSpace(envelope.Address), 4)
+}
@@ -1,28 +1,47 @@
 package utils
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
-	"strings"
 	"time"
 )
 
-const checkipURL string = "https://checkip.amazonaws.com/"
-
 // NewBrowser returns HTTP client.
 func NewBrowser() (*http.Client, error) {
+	return newBrowser("tcp")
+}
+
+// NewBrowserForVersion returns HTTP client connecting over the network of
+// the provided IP version only.
+func NewBrowserForVersion(version int) (*http.Client, error) {
+	switch version {
+	case 4:
+		return newBrowser("tcp4")
+	case 6:
+		return newBrowser("tcp6")
+	}
+	return nil, fmt.Errorf("invalid ip version %d", version)
+}
+
+// newBrowser returns HTTP client dialing over the provided network,
+// e.g. tcp4 or tcp6.
+func newBrowser(network string) (*http.Client, error) {
 	cj, err := cookiejar.New(nil)
 	if err != nil {
 		return nil, fmt.Errorf("cookier jar error: %s", err)
 	}
 
+	dialer := &net.Dialer{
+		Timeout: 3 * time.Second,
+	}
+
 	tr := &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout: 3 * time.Second,
-		}).Dial,
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
 		TLSHandshakeTimeout: 3 * time.Second,
 	}
 
@@ -35,43 +54,30 @@ func NewBrowser() (*http.Client, error) {
 	return client, nil
 }
 
-// GetPublicAddress returns public IP address of the host
-// where this function is running on.
-func GetPublicAddress(version int) (string, error) {
-	if version != 4 {
-		return "", fmt.Errorf("only ip version 4 is supported")
+// ParseAddress parses the IP address of the provided IP version and
+// returns it in canonical form.
+func ParseAddress(s string, version int) (string, error) {
+	address := net.ParseIP(s)
+	if address == nil {
+		return "", fmt.Errorf("error parsing ip address from %q", s)
 	}
-
-	browser, err := NewBrowser()
-	if err != nil {
+	if err := MatchAddressVersion(address, version); err != nil {
 		return "", err
 	}
+	return address.String(), nil
+}
 
-	req, err := http.NewRequest("GET", checkipURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("error creating http get: %s", err)
-	}
-
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/77.0.3865.90 Safari/537.36")
-	resp, err := browser.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("http request error: %s", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("error reading response body: %s", err)
-	}
-	responseBody := string(body[:])
-	responseBody = strings.TrimSpace(responseBody)
-	address := net.ParseIP(responseBody)
-	if address == nil {
-		return "", fmt.Errorf("error parsing ip address from %s", responseBody)
+// MatchAddressVersion returns error if the provided IP address does
+// not belong to the provided IP version.
+func MatchAddressVersion(address net.IP, version int) error {
+	isVersion4 := address.To4() != nil
+	switch {
+	case version == 4 && !isVersion4:
+		return fmt.Errorf("ip address %s is not ip version 4", address)
+	case version == 6 && isVersion4:
+		return fmt.Errorf("ip address %s is not ip version 6", address)
+	case version != 4 && version != 6:
+		return fmt.Errorf("invalid ip version %d", version)
 	}
-	if address.String() != responseBody {
-		return "", fmt.Errorf("error parsing ip address: %s (received) vs. %s (parsed)", responseBody, address.String())
-	}
-
-	return address.String(), nil
+	return nil
 }
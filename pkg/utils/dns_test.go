@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestResolveName(t *testing.T) {
+	server := startDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		q := req.Question[0]
+		switch {
+		case q.Name == "app.contoso.com." && q.Qtype == dns.TypeA:
+			rr, _ := dns.NewRR("app.contoso.com. 60 IN A 203.0.113.10")
+			resp.Answer = append(resp.Answer, rr)
+		case q.Name == "app.contoso.com." && q.Qtype == dns.TypeAAAA:
+			rr, _ := dns.NewRR("app.contoso.com. 60 IN AAAA 2001:db8::10")
+			resp.Answer = append(resp.Answer, rr)
+		default:
+			resp.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(resp)
+	})
+	resolver, err := NewResolver([]string{server}, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultResolver := DefaultResolver
+	DefaultResolver = resolver
+	defer func() { DefaultResolver = defaultResolver }()
+
+	testcases := []struct {
+		name      string
+		record    string
+		version   int
+		want      []string
+		shouldErr bool
+	}{
+		{name: "ipv4 address", record: "app.contoso.com", version: 4, want: []string{"203.0.113.10"}},
+		{name: "ipv6 address", record: "app.contoso.com", version: 6, want: []string{"2001:db8::10"}},
+		{name: "unknown record", record: "www.contoso.com", version: 6, want: []string{}},
+		{name: "invalid ip version", record: "app.contoso.com", version: 5, shouldErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			addrs, err := ResolveName(tc.record, tc.version)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", addrs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(addrs, tc.want) {
+				t.Fatalf("unexpected addresses: %v (actual) vs. %v (expected)", addrs, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/miekg/dns"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultResolverTimeout = 5 * time.Second
+	// dohMediaType is the media type of DNS-over-HTTPS messages (RFC 8484).
+	dohMediaType = "application/dns-message"
+	// maxZoneCacheTTL is the maximum time the name servers of a zone are
+	// cached for in the authoritative mode.
+	maxZoneCacheTTL = time.Hour
+)
+
+// Resolver resolves the addresses of DNS records. By default, the queries
+// are sent to the recursive servers. In the authoritative mode, the zone of
+// the record and its name servers are looked up with the recursive servers,
+// and the queries are sent to the name servers with recursion disabled. The
+// answers then reflect the published records rather than the cached ones.
+//
+// The scheme of a server selects the transport: tls:// for DNS-over-TLS,
+// https:// for DNS-over-HTTPS, tcp:// for DNS over TCP, and plain DNS
+// otherwise. The name servers of a zone are always queried with plain DNS.
+type Resolver struct {
+	servers       []string
+	authoritative bool
+	timeout       time.Duration
+	nsPort        string
+	rootCAs       *x509.CertPool
+	httpClient    *http.Client
+	mu            sync.Mutex
+	zones         map[string]*zoneServers
+}
+
+// zoneServers are the cached name servers of the zone of a record.
+type zoneServers struct {
+	zone    string
+	servers []string
+	expires time.Time
+}
+
+// NewResolver returns an instance of Resolver sending queries to the
+// provided servers. The port of a server defaults to 53, or to 853 for
+// DNS-over-TLS.
+func NewResolver(servers []string, authoritative bool, timeout time.Duration) (*Resolver, error) {
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("resolver requires at least one server")
+	}
+	if timeout == 0 {
+		timeout = defaultResolverTimeout
+	}
+	r := &Resolver{
+		authoritative: authoritative,
+		timeout:       timeout,
+		nsPort:        "53",
+		httpClient:    &http.Client{Timeout: timeout},
+		zones:         make(map[string]*zoneServers),
+	}
+	for _, server := range servers {
+		addr, err := parseServerAddress(server)
+		if err != nil {
+			return nil, err
+		}
+		r.servers = append(r.servers, addr)
+	}
+	return r, nil
+}
+
+// mustNewResolver is like NewResolver, but panics on error. It initializes
+// the package level resolvers.
+func mustNewResolver(servers []string, authoritative bool, timeout time.Duration) *Resolver {
+	r, err := NewResolver(servers, authoritative, timeout)
+	if err != nil {
+		panic("utils: " + err.Error())
+	}
+	return r
+}
+
+// setRootCAs sets the certificate authorities DNS-over-TLS and
+// DNS-over-HTTPS servers are verified with, instead of the system ones.
+func (r *Resolver) setRootCAs(pool *x509.CertPool) {
+	r.rootCAs = pool
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+	r.httpClient = &http.Client{Timeout: r.timeout, Transport: transport}
+}
+
+// NewSystemResolver returns an instance of Resolver sending queries to the
+// servers listed in the provided resolv.conf file.
+func NewSystemResolver(path string, authoritative bool, timeout time.Duration) (*Resolver, error) {
+	cfg, err := dns.ClientConfigFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading %s: %s", path, err)
+	}
+	servers := []string{}
+	for _, server := range cfg.Servers {
+		servers = append(servers, net.JoinHostPort(server, cfg.Port))
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no servers found in %s", path)
+	}
+	return NewResolver(servers, authoritative, timeout)
+}
+
+// parseServerAddress returns the address of a server with port, prefixed
+// with the scheme of its transport, or the URL of DNS-over-HTTPS server.
+func parseServerAddress(s string) (string, error) {
+	scheme, port := "", "53"
+	if i := strings.Index(s, "://"); i >= 0 {
+		scheme = strings.ToLower(s[:i])
+		switch scheme {
+		case "https":
+			u, err := url.Parse(s)
+			if err != nil || u.Host == "" {
+				return "", fmt.Errorf("invalid server %q", s)
+			}
+			return u.String(), nil
+		case "tls", "tcp-tls":
+			scheme, port = "tls", "853"
+		case "tcp":
+		case "udp":
+			scheme = ""
+		default:
+			return "", fmt.Errorf("invalid server %q, unsupported scheme %s", s, scheme)
+		}
+		s = strings.TrimSuffix(s[i+3:], "/")
+	}
+	host, p, err := net.SplitHostPort(s)
+	if err != nil {
+		host, p = strings.Trim(s, "[]"), port
+	}
+	if host == "" {
+		return "", fmt.Errorf("invalid server %q", s)
+	}
+	if scheme != "" {
+		return scheme + "://" + net.JoinHostPort(host, p), nil
+	}
+	return net.JoinHostPort(host, p), nil
+}
+
+// getQueryType returns DNS query type for the provided IP version.
+func getQueryType(version int) (uint16, error) {
+	switch version {
+	case 4:
+		return dns.TypeA, nil
+	case 6:
+		return dns.TypeAAAA, nil
+	}
+	return 0, fmt.Errorf("invalid ip version %d", version)
+}
+
+// Resolve returns the addresses of the provided IP version associated with
+// the provided DNS record. A record not found in DNS has no addresses.
+func (r *Resolver) Resolve(name string, version int) ([]string, error) {
+	addrs := []string{}
+	qtype, err := getQueryType(version)
+	if err != nil {
+		return addrs, err
+	}
+
+	servers := r.servers
+	if r.authoritative {
+		servers, err = r.getAuthoritativeServers(name)
+		if err != nil {
+			return addrs, err
+		}
+	}
+
+	resp, err := r.query(servers, name, qtype, !r.authoritative)
+	if err != nil {
+		return addrs, err
+	}
+	for _, rr := range resp.Answer {
+		switch t := rr.(type) {
+		case *dns.A:
+			addrs = append(addrs, t.A.String())
+		case *dns.AAAA:
+			addrs = append(addrs, t.AAAA.String())
+		}
+	}
+	return addrs, nil
+}
+
+// query sends the query to the provided servers in order until one of them
+// answers. When recursion is not desired, only authoritative answers are
+// accepted.
+func (r *Resolver) query(servers []string, name string, qtype uint16, recursive bool) (*dns.Msg, error) {
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), qtype)
+	req.RecursionDesired = recursive
+
+	var errs []string
+	for _, server := range servers {
+		resp, err := r.exchange(req, server)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", server, err))
+			continue
+		}
+		if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+			errs = append(errs, fmt.Sprintf("%s: %s", server, dns.RcodeToString[resp.Rcode]))
+			continue
+		}
+		if !recursive && !resp.Authoritative {
+			errs = append(errs, fmt.Sprintf("%s: non-authoritative answer", server))
+			continue
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("%s %s query failed: %s", dns.Fqdn(name), dns.TypeToString[qtype], strings.Join(errs, ", "))
+}
+
+// exchange sends the request to the server using the transport selected
+// by the scheme of the server. The plain DNS requests are sent over UDP,
+// and retried over TCP when the response is truncated.
+func (r *Resolver) exchange(req *dns.Msg, server string) (*dns.Msg, error) {
+	req.Id = dns.Id()
+	switch {
+	case strings.HasPrefix(server, "https://"):
+		return r.exchangeHTTPS(req, server)
+	case strings.HasPrefix(server, "tls://"):
+		addr := strings.TrimPrefix(server, "tls://")
+		host, _, _ := net.SplitHostPort(addr)
+		client := &dns.Client{
+			Net:     "tcp-tls",
+			Timeout: r.timeout,
+			TLSConfig: &tls.Config{
+				ServerName: host,
+				RootCAs:    r.rootCAs,
+				MinVersion: tls.VersionTLS12,
+			},
+		}
+		resp, _, err := client.Exchange(req, addr)
+		return resp, err
+	case strings.HasPrefix(server, "tcp://"):
+		client := &dns.Client{Net: "tcp", Timeout: r.timeout}
+		resp, _, err := client.Exchange(req, strings.TrimPrefix(server, "tcp://"))
+		return resp, err
+	}
+	client := &dns.Client{Net: "udp", Timeout: r.timeout}
+	resp, _, err := client.Exchange(req, server)
+	if err == nil && resp.Truncated {
+		client.Net = "tcp"
+		resp, _, err = client.Exchange(req, server)
+	}
+	return resp, err
+}
+
+// exchangeHTTPS sends the request to DNS-over-HTTPS server in the wire
+// format (RFC 8484). The message ID of the request is zero, as recommended
+// for HTTP caching, and is restored in the response.
+func (r *Resolver) exchangeHTTPS(req *dns.Msg, server string) (*dns.Msg, error) {
+	id := req.Id
+	req.Id = 0
+	buf, err := req.Pack()
+	req.Id = id
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest("POST", server, bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", dohMediaType)
+	httpReq.Header.Set("Accept", dohMediaType)
+	httpResp, err := r.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http request failed with status code %d", httpResp.StatusCode)
+	}
+	ct := httpResp.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(ct); err != nil || mediaType != dohMediaType {
+		return nil, fmt.Errorf("unexpected content type %q", ct)
+	}
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+	resp := new(dns.Msg)
+	if err := resp.Unpack(body); err != nil {
+		return nil, fmt.Errorf("malformed response: %s", err)
+	}
+	resp.Id = id
+	return resp, nil
+}
+
+// getAuthoritativeServers returns the addresses of the name servers of the
+// zone of the provided record.
+func (r *Resolver) getAuthoritativeServers(name string) ([]string, error) {
+	name = dns.Fqdn(strings.ToLower(name))
+	r.mu.Lock()
+	entry, exists := r.zones[name]
+	r.mu.Unlock()
+	if exists && time.Now().Before(entry.expires) {
+		return entry.servers, nil
+	}
+
+	zone, err := r.findZone(name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.query(r.servers, zone, dns.TypeNS, true)
+	if err != nil {
+		return nil, err
+	}
+	ttl := maxZoneCacheTTL
+	hosts := []string{}
+	for _, rr := range resp.Answer {
+		if ns, ok := rr.(*dns.NS); ok {
+			hosts = append(hosts, ns.Ns)
+			if t := time.Duration(ns.Hdr.Ttl) * time.Second; t < ttl {
+				ttl = t
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no name servers found for zone %s", zone)
+	}
+
+	// The IPv4 addresses of the name servers are tried first.
+	servers := []string{}
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		for _, host := range hosts {
+			resp, err := r.query(r.servers, host, qtype, true)
+			if err != nil {
+				continue
+			}
+			for _, rr := range resp.Answer {
+				switch t := rr.(type) {
+				case *dns.A:
+					servers = append(servers, net.JoinHostPort(t.A.String(), r.nsPort))
+				case *dns.AAAA:
+					servers = append(servers, net.JoinHostPort(t.AAAA.String(), r.nsPort))
+				}
+			}
+		}
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no addresses found for name servers of zone %s: %s", zone, strings.Join(hosts, ", "))
+	}
+
+	r.mu.Lock()
+	r.zones[name] = &zoneServers{zone: zone, servers: servers, expires: time.Now().Add(ttl)}
+	r.mu.Unlock()
+	return servers, nil
+}
+
+// findZone returns the name of the zone the provided record belongs to. The
+// SOA record is in the answer section when the record is the apex of the
+// zone, and in the authority section otherwise.
+func (r *Resolver) findZone(name string) (string, error) {
+	resp, err := r.query(r.servers, name, dns.TypeSOA, true)
+	if err != nil {
+		return "", err
+	}
+	for _, rr := range resp.Answer {
+		if soa, ok := rr.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, name) {
+			return soa.Hdr.Name, nil
+		}
+	}
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Hdr.Name, nil
+		}
+	}
+	return "", fmt.Errorf("zone of %s not found", name)
+}
@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// startDNSServer starts a DNS server on a random local UDP port.
+func startDNSServer(t *testing.T, handler dns.HandlerFunc) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &dns.Server{PacketConn: conn, Handler: handler}
+	go srv.ActivateAndServe()
+	t.Cleanup(func() { srv.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+func TestResolver(t *testing.T) {
+	// The authoritative server of contoso.com zone has the published
+	// address of the record.
+	auth := startDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		resp.Authoritative = true
+		q := req.Question[0]
+		switch {
+		case req.RecursionDesired:
+			resp.Rcode = dns.RcodeRefused
+			resp.Authoritative = false
+		case q.Name == "app.contoso.com." && q.Qtype == dns.TypeA:
+			rr, _ := dns.NewRR("app.contoso.com. 60 IN A 203.0.113.10")
+			resp.Answer = append(resp.Answer, rr)
+		default:
+			resp.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(resp)
+	})
+	_, authPort, _ := net.SplitHostPort(auth)
+
+	// The recursive server has the cached, stale address of the record.
+	recursive := startDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		resp.RecursionAvailable = true
+		q := req.Question[0]
+		switch {
+		case q.Name == "app.contoso.com." && q.Qtype == dns.TypeA:
+			rr, _ := dns.NewRR("app.contoso.com. 60 IN A 198.51.100.1")
+			resp.Answer = append(resp.Answer, rr)
+		case q.Name == "app.contoso.com." && q.Qtype == dns.TypeSOA:
+			rr, _ := dns.NewRR("contoso.com. 900 IN SOA ns1.contoso.com. admin.contoso.com. 1 7200 900 1209600 86400")
+			resp.Ns = append(resp.Ns, rr)
+		case q.Name == "contoso.com." && q.Qtype == dns.TypeNS:
+			rr, _ := dns.NewRR("contoso.com. 3600 IN NS ns1.contoso.com.")
+			resp.Answer = append(resp.Answer, rr)
+		case q.Name == "ns1.contoso.com." && q.Qtype == dns.TypeA:
+			rr, _ := dns.NewRR("ns1.contoso.com. 3600 IN A 127.0.0.1")
+			resp.Answer = append(resp.Answer, rr)
+		case q.Name == "ns1.contoso.com." && q.Qtype == dns.TypeAAAA:
+		default:
+			resp.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(resp)
+	})
+
+	testcases := []struct {
+		name          string
+		record        string
+		version       int
+		authoritative bool
+		want          []string
+	}{
+		{name: "recursive", record: "app.contoso.com", version: 4, want: []string{"198.51.100.1"}},
+		{name: "authoritative", record: "app.contoso.com", version: 4, authoritative: true, want: []string{"203.0.113.10"}},
+		{name: "record not found", record: "www.contoso.com", version: 4, want: []string{}},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewResolver([]string{recursive}, tc.authoritative, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			r.nsPort = authPort
+			addrs, err := r.Resolve(tc.record, tc.version)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(addrs, tc.want) {
+				t.Fatalf("unexpected addresses: %v (actual) vs. %v (expected)", addrs, tc.want)
+			}
+			if tc.authoritative {
+				servers := r.zones["app.contoso.com."].servers
+				if !reflect.DeepEqual(servers, []string{auth}) {
+					t.Fatalf("unexpected authoritative servers: %v", servers)
+				}
+			}
+		})
+	}
+}
+
+func TestNewSystemResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	if err := os.WriteFile(path, []byte("search contoso.com\nnameserver 192.0.2.53\nnameserver 2001:db8::53\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewSystemResolver(path, false, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{"192.0.2.53:53", "[2001:db8::53]:53"}
+	if !reflect.DeepEqual(r.servers, want) {
+		t.Fatalf("unexpected servers: %v (actual) vs. %v (expected)", r.servers, want)
+	}
+}
+
+// answerHandler answers A queries for app.contoso.com.
+func answerHandler(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	if req.Question[0].Name == "app.contoso.com." && req.Question[0].Qtype == dns.TypeA {
+		rr, _ := dns.NewRR("app.contoso.com. 60 IN A 203.0.113.10")
+		resp.Answer = append(resp.Answer, rr)
+	}
+	w.WriteMsg(resp)
+}
+
+func TestResolverTransports(t *testing.T) {
+	// DNS-over-HTTPS server
+	doh := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dohMediaType {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil || req.Id != 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		if req.Question[0].Name == "app.contoso.com." {
+			rr, _ := dns.NewRR("app.contoso.com. 60 IN A 203.0.113.10")
+			resp.Answer = append(resp.Answer, rr)
+		}
+		buf, _ := resp.Pack()
+		// The media types are case-insensitive, and may have parameters.
+		w.Header().Set("Content-Type", "Application/DNS-Message; charset=binary")
+		w.Write(buf)
+	}))
+	defer doh.Close()
+
+	// DNS-over-TLS server with the certificate of the HTTPS server
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: doh.TLS.Certificates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot := &dns.Server{Listener: ln, Net: "tcp-tls", Handler: dns.HandlerFunc(answerHandler)}
+	go dot.ActivateAndServe()
+	defer dot.Shutdown()
+
+	// DNS over TCP server
+	tcpLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp := &dns.Server{Listener: tcpLn, Net: "tcp", Handler: dns.HandlerFunc(answerHandler)}
+	go tcp.ActivateAndServe()
+	defer tcp.Shutdown()
+
+	testcases := []struct {
+		name   string
+		server string
+	}{
+		{name: "dns over https", server: doh.URL + "/dns-query"},
+		{name: "dns over tls", server: "tls://" + ln.Addr().String()},
+		{name: "dns over tls with tcp-tls scheme", server: "tcp-tls://" + ln.Addr().String()},
+		{name: "dns over tcp", server: "tcp://" + tcpLn.Addr().String()},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewResolver([]string{tc.server}, false, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			r.setRootCAs(doh.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs)
+			addrs, err := r.Resolve("app.contoso.com", 4)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(addrs, []string{"203.0.113.10"}) {
+				t.Fatalf("unexpected addresses: %v", addrs)
+			}
+		})
+	}
+}
+
+func TestParseServerAddress(t *testing.T) {
+	testcases := []struct {
+		server    string
+		want      string
+		shouldErr bool
+	}{
+		{server: "8.8.8.8", want: "8.8.8.8:53"},
+		{server: "2001:4860:4860::8888", want: "[2001:4860:4860::8888]:53"},
+		{server: "udp://9.9.9.9:5353", want: "9.9.9.9:5353"},
+		{server: "tcp://9.9.9.9", want: "tcp://9.9.9.9:53"},
+		{server: "tls://1.1.1.1", want: "tls://1.1.1.1:853"},
+		{server: "tcp-tls://dns.google:8853", want: "tls://dns.google:8853"},
+		{server: "https://cloudflare-dns.com/dns-query", want: "https://cloudflare-dns.com/dns-query"},
+		{server: "quic://dns.adguard.com", shouldErr: true},
+		{server: "https:///dns-query", shouldErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.server, func(t *testing.T) {
+			addr, err := parseServerAddress(tc.server)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if addr != tc.want {
+				t.Fatalf("unexpected address: %s (actual) vs. %s (expected)", addr, tc.want)
+			}
+		})
+	}
+}
@@ -1,31 +1,74 @@
 package dyndns
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"github.com/greenpau/dyndns/pkg/providers/route53"
+	"github.com/greenpau/dyndns/pkg/providers"
 	"github.com/greenpau/dyndns/pkg/record"
 	"go.uber.org/zap"
+
+	// Register DNS provider engines.
+	_ "github.com/greenpau/dyndns/pkg/providers/cloudflare"
+	_ "github.com/greenpau/dyndns/pkg/providers/dyndns2"
+	_ "github.com/greenpau/dyndns/pkg/providers/rfc2136"
+	_ "github.com/greenpau/dyndns/pkg/providers/route53"
 )
 
-// RegistrationProvider is a receiving instance.
+// RegistrationProvider is a receiving instance. The lookup overrides the
+// global lookup setting for the records registered with the provider.
 type RegistrationProvider struct {
 	config []byte
 	engine RegistrationEngine
+	lookup string
+}
+
+// providerSettings are the settings common to all DNS provider engines.
+type providerSettings struct {
+	Lookup string `json:"lookup,omitempty" yaml:"lookup,omitempty"`
 }
 
 // RegistrationEngine is a receiving instance interface.
 type RegistrationEngine interface {
-	Configure(*zap.Logger) error
-	Validate() error
-	GetProvider() string
-	Register(*record.RegistrationRecord) error
+	providers.Engine
+}
+
+// Register registers the address of the provided IP version of a DNS record
+// with RegistrationEngine.
+func (p *RegistrationProvider) Register(r *record.RegistrationRecord, version int) error {
+	return p.engine.Register(r, version)
+}
+
+// RegisterOutdated registers the address of the provided IP version of
+// a DNS record whose addresses, as returned by Lookup, are outdated. The
+// engines looking the record up before the registration skip the lookup.
+func (p *RegistrationProvider) RegisterOutdated(r *record.RegistrationRecord, version int, current []string) error {
+	if engine, ok := p.engine.(providers.OutdatedRegistrar); ok {
+		return engine.RegisterOutdated(r, version, current)
+	}
+	return p.engine.Register(r, version)
+}
+
+// Stop interrupts the registrations in progress with RegistrationEngine,
+// if the engine supports it.
+func (p *RegistrationProvider) Stop() {
+	if engine, ok := p.engine.(providers.Stopper); ok {
+		engine.Stop()
+	}
 }
 
-// Register registers DNS record with RegistrationEngine.
-func (p *RegistrationProvider) Register(r *record.RegistrationRecord) error {
-	return p.engine.Register(r)
+// getLookup returns the lookup of the records registered with the provider,
+// falling back to the provided global lookup.
+func (p *RegistrationProvider) getLookup(lookup string) string {
+	if p.lookup != "" {
+		return p.lookup
+	}
+	return lookup
+}
+
+// Lookup returns the addresses of the provided IP version of a DNS record
+// as known to RegistrationEngine.
+func (p *RegistrationProvider) Lookup(r *record.RegistrationRecord, version int) ([]string, error) {
+	return p.engine.Lookup(r, version)
 }
 
 // GetProvider returns the Provider associated with RegistrationProvider.
@@ -38,6 +81,9 @@ func (p *RegistrationProvider) Validate() error {
 	if p.engine == nil {
 		return fmt.Errorf("failed to initialize dns provider instance")
 	}
+	if err := validateLookup(p.lookup); err != nil {
+		return err
+	}
 	return p.engine.Validate()
 }
 
@@ -56,22 +102,36 @@ func (p RegistrationProvider) MarshalJSON() ([]byte, error) {
 
 // UnmarshalJSON unpacks configuration into appropriate structures.
 func (p *RegistrationProvider) UnmarshalJSON(inputConfig []byte) error {
-	if len(inputConfig) < 10 {
-		return fmt.Errorf("invalid dns provider configuration: %s", inputConfig)
+	_, engine, err := decodeTyped("dns provider", jsonUnmarshaler(inputConfig), providers.New)
+	if err != nil {
+		return err
 	}
-
-	data := bytes.Replace(inputConfig, []byte("\": \""), []byte("\":\""), -1)
-
-	route53Config := []byte("\"type\":\"route53\"")
-	if bytes.Contains(data, route53Config) {
-		engine := &route53.RegistrationProvider{}
-		if err := json.Unmarshal(data, engine); err != nil {
-			return fmt.Errorf("invalid dns provider configuration, error: %s, config: %s", err, data)
-		}
-		p.engine = engine
-		p.config = data
-		return nil
+	settings := &providerSettings{}
+	if err := jsonUnmarshaler(inputConfig)(settings); err != nil {
+		return fmt.Errorf("invalid dns provider configuration, error: %s", err)
 	}
+	p.engine = engine
+	p.lookup = settings.Lookup
+	p.config = append([]byte(nil), inputConfig...)
+	return nil
+}
 
-	return fmt.Errorf("valid dns provider not found, invalid configuration: %s", data)
+// UnmarshalYAML unpacks YAML configuration into appropriate structures.
+func (p *RegistrationProvider) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	_, engine, err := decodeTyped("dns provider", unmarshal, providers.New)
+	if err != nil {
+		return err
+	}
+	settings := &providerSettings{}
+	if err := unmarshal(settings); err != nil {
+		return fmt.Errorf("invalid dns provider configuration, error: %s", err)
+	}
+	config, err := json.Marshal(engine)
+	if err != nil {
+		return fmt.Errorf("invalid dns provider configuration, error: %s", err)
+	}
+	p.engine = engine
+	p.lookup = settings.Lookup
+	p.config = config
+	return nil
 }
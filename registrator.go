@@ -1,8 +1,11 @@
 package dyndns
 
 import (
-	//	"fmt"
-	"github.com/greenpau/dyndns/pkg/utils"
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/providers"
+	"github.com/greenpau/dyndns/pkg/record"
+	"github.com/greenpau/dyndns/pkg/sources"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,16 +18,18 @@ func runRegistrationManager(s *Server, parentWaitGroup *sync.WaitGroup) {
 
 	var fn = s.name + "-registration-mgr"
 	syncInterval := float64(s.cfg.SyncInterval)
-	record := s.cfg.Record
-	provider := s.cfg.Provider
 	s.log.Debug(
 		"starting sybsystem",
 		zap.String("subsystem", fn),
 		zap.String("app", s.name),
 		zap.Any("sync_interval", syncInterval),
-		zap.Any("record", s.cfg.Record),
+		zap.Any("records", s.cfg.Records),
 	)
 
+	done := make(chan struct{})
+	defer close(done)
+	trigger := startAddressWatcher(s, fn, done)
+
 	initialized := false
 	timer := time.Now()
 	intervals := time.NewTicker(time.Millisecond * time.Duration(250))
@@ -47,8 +52,14 @@ func runRegistrationManager(s *Server, parentWaitGroup *sync.WaitGroup) {
 				zap.String("app", s.name),
 			)
 		default:
+			var triggered bool
+			select {
+			case <-trigger:
+				triggered = true
+			default:
+			}
 			elapsed := time.Since(timer)
-			if elapsed.Seconds() < syncInterval {
+			if !triggered && elapsed.Seconds() < syncInterval {
 				if initialized {
 					continue
 				}
@@ -56,97 +67,7 @@ func runRegistrationManager(s *Server, parentWaitGroup *sync.WaitGroup) {
 			}
 			timer = time.Now()
 			syncInterval = float64(s.cfg.SyncInterval)
-			if record.Version4 {
-				// Get the public IP address of the host running this service
-				s.log.Debug(
-					"checking public ip address",
-					zap.String("subsystem", fn),
-					zap.String("app", s.name),
-				)
-
-				addr, err := utils.GetPublicAddress(4)
-				if err != nil {
-					s.log.Error(
-						"checking public ip address failed",
-						zap.String("subsystem", fn),
-						zap.String("app", s.name),
-						zap.String("error", err.Error()),
-					)
-					continue
-				}
-				s.log.Debug(
-					"obtained public ip address",
-					zap.String("subsystem", fn),
-					zap.String("app", s.name),
-					zap.Any("address", addr),
-				)
-
-				// Resolve the IP address associated with DNS A/AAAA record
-
-				s.log.Debug(
-					"resolving dns record",
-					zap.String("subsystem", fn),
-					zap.String("app", s.name),
-					zap.Any("record", record),
-				)
-				dnsAddrs, err := utils.ResolveName(record.Name, 4)
-				if err != nil {
-					s.log.Error(
-						"resolving dns record failed",
-						zap.String("subsystem", fn),
-						zap.String("app", s.name),
-						zap.Any("record", record),
-						zap.String("error", err.Error()),
-					)
-					continue
-				}
-				s.log.Debug(
-					"resolved dns record",
-					zap.String("subsystem", fn),
-					zap.String("app", s.name),
-					zap.Any("record", record),
-					zap.Any("addresses", dnsAddrs),
-				)
-
-				if len(dnsAddrs) == 1 {
-					if dnsAddrs[0] == addr {
-						s.log.Debug(
-							"dns record is up to date",
-							zap.String("subsystem", fn),
-							zap.String("app", s.name),
-							zap.Any("record", record),
-							zap.Any("public_ip", addr),
-							zap.Any("dns_addresses", dnsAddrs),
-						)
-						continue
-					}
-				}
-
-				// Update DNS record could be outdated
-				if err := record.SetAddress(addr, 4); err != nil {
-					s.log.Error(
-						"failed updating internal dns record",
-						zap.String("subsystem", fn),
-						zap.String("app", s.name),
-						zap.Any("record", record),
-						zap.String("error", err.Error()),
-					)
-					continue
-				}
-
-				if err := provider.Register(record); err != nil {
-					s.log.Error(
-						"dns record update failed",
-						zap.String("subsystem", fn),
-						zap.String("app", s.name),
-						zap.Any("record", record),
-						zap.Any("public_ip", addr),
-						zap.Any("dns_addresses", dnsAddrs),
-						zap.String("error", err.Error()),
-					)
-					continue
-				}
-
+			if runRegistrationCycle(s, fn) {
 				syncInterval = float64(s.cfg.SyncInterval) * float64(5)
 			}
 		}
@@ -162,3 +83,304 @@ func runRegistrationManager(s *Server, parentWaitGroup *sync.WaitGroup) {
 	return
 
 }
+
+// runRegistrationCycle reconciles all configured records. The public
+// address of each IP version is discovered once per cycle and shared by
+// the records. Each IP version is handled independently, i.e. a failure
+// to discover IPv6 address does not prevent A record update. It returns
+// true when at least one record was updated.
+func runRegistrationCycle(s *Server, fn string) bool {
+	var updated bool
+	publicAddrs := make(map[int]string)
+	publicErrs := make(map[int]error)
+
+	for _, r := range s.cfg.Records {
+		provider, err := s.cfg.getProvider(r.Provider)
+		for _, version := range r.GetVersions() {
+			if err != nil {
+				reportRecordStatus(s, fn, r, version, record.StateFailed, "", err)
+				continue
+			}
+			if _, exists := publicAddrs[version]; !exists && publicErrs[version] == nil {
+				publicAddrs[version], publicErrs[version] = discoverPublicAddress(s, fn, version)
+			}
+			if publicErrs[version] != nil {
+				reportRecordStatus(s, fn, r, version, record.StateFailed, "", publicErrs[version])
+				continue
+			}
+			addr := publicAddrs[version]
+			state, err := registerRecordAddress(s, fn, provider, r, version, addr)
+			if state == record.StateUpdated {
+				updated = true
+			}
+			reportRecordStatus(s, fn, r, version, state, addr, err)
+		}
+	}
+	return updated
+}
+
+// reportRecordStatus records the outcome of a registration attempt and logs
+// it. Failures are always logged as errors, while other outcomes are logged
+// at the info level only when the status of the record changes.
+func reportRecordStatus(s *Server, fn string, r *record.RegistrationRecord, version int, state, addr string, err error) {
+	changed := r.SetStatus(version, state, addr, err)
+	if err != nil {
+		s.log.Error(
+			"dns record registration failed",
+			zap.String("subsystem", fn),
+			zap.String("app", s.name),
+			zap.String("record", r.Name),
+			zap.String("provider", r.Provider),
+			zap.Int("ip_version", version),
+			zap.String("state", state),
+			zap.String("public_ip", addr),
+			zap.String("error", err.Error()),
+		)
+		return
+	}
+	logFn := s.log.Debug
+	if changed {
+		logFn = s.log.Info
+	}
+	logFn(
+		"dns record status",
+		zap.String("subsystem", fn),
+		zap.String("app", s.name),
+		zap.String("record", r.Name),
+		zap.String("provider", r.Provider),
+		zap.Int("ip_version", version),
+		zap.String("state", state),
+		zap.String("public_ip", addr),
+	)
+}
+
+// discoverPublicAddress returns the public IP address of the provided IP
+// version of the host running this service. The address sources are tried
+// in order until one of them succeeds, unless address quorum is configured.
+func discoverPublicAddress(s *Server, fn string, version int) (string, error) {
+	s.log.Debug(
+		"checking public ip address",
+		zap.String("subsystem", fn),
+		zap.String("app", s.name),
+		zap.Int("ip_version", version),
+	)
+
+	if s.cfg.AddressQuorum > 0 {
+		return discoverConsensusAddress(s, fn, version)
+	}
+
+	errs := []string{}
+	for i, source := range s.cfg.AddressSources {
+		addr, err := source.GetAddress(version)
+		if err == sources.ErrVersionNotSupported {
+			continue
+		}
+		if err != nil {
+			s.log.Warn(
+				"address source failed",
+				zap.String("subsystem", fn),
+				zap.String("app", s.name),
+				zap.Int("ip_version", version),
+				zap.Int("source_id", i),
+				zap.String("source", source.GetSource()),
+				zap.String("error", err.Error()),
+			)
+			errs = append(errs, fmt.Sprintf("%s source %d: %s", source.GetSource(), i, err))
+			continue
+		}
+		s.log.Debug(
+			"obtained public ip address",
+			zap.String("subsystem", fn),
+			zap.String("app", s.name),
+			zap.Int("ip_version", version),
+			zap.Int("source_id", i),
+			zap.String("source", source.GetSource()),
+			zap.Any("address", addr),
+		)
+		return addr, nil
+	}
+
+	if len(errs) == 0 {
+		return "", fmt.Errorf("checking public ip address failed: no address sources for ip version %d", version)
+	}
+	return "", fmt.Errorf("checking public ip address failed: %s", strings.Join(errs, "; "))
+}
+
+// discoverConsensusAddress queries the address sources in parallel and
+// returns the address reported by at least the quorum of the sources.
+func discoverConsensusAddress(s *Server, fn string, version int) (string, error) {
+	type result struct {
+		addr string
+		err  error
+	}
+	results := make([]result, len(s.cfg.AddressSources))
+	var wg sync.WaitGroup
+	for i, source := range s.cfg.AddressSources {
+		wg.Add(1)
+		go func(i int, source *AddressSource) {
+			defer wg.Done()
+			addr, err := source.GetAddress(version)
+			results[i] = result{addr: addr, err: err}
+		}(i, source)
+	}
+	wg.Wait()
+
+	votes := make(map[string]int)
+	answers := make(map[string]string)
+	var participants, successes int
+	var consensusAddr string
+	for i, r := range results {
+		if r.err == sources.ErrVersionNotSupported {
+			continue
+		}
+		participants++
+		k := fmt.Sprintf("%s_%d", s.cfg.AddressSources[i].GetSource(), i)
+		if r.err != nil {
+			answers[k] = "error: " + r.err.Error()
+			continue
+		}
+		answers[k] = r.addr
+		successes++
+		votes[r.addr]++
+		if votes[r.addr] > votes[consensusAddr] {
+			consensusAddr = r.addr
+		}
+	}
+
+	if len(votes) > 1 || successes < participants {
+		s.log.Warn(
+			"address sources disagree",
+			zap.String("subsystem", fn),
+			zap.String("app", s.name),
+			zap.Int("ip_version", version),
+			zap.Any("answers", answers),
+		)
+	}
+
+	if consensusAddr == "" || uint64(votes[consensusAddr]) < s.cfg.AddressQuorum {
+		return "", fmt.Errorf(
+			"checking public ip address failed: quorum of %d not reached, %d of %d sources agree on %q",
+			s.cfg.AddressQuorum, votes[consensusAddr], participants, consensusAddr,
+		)
+	}
+
+	for addr, n := range votes {
+		if addr != consensusAddr && n == votes[consensusAddr] {
+			return "", fmt.Errorf(
+				"checking public ip address failed: sources are split between %s and %s",
+				consensusAddr, addr,
+			)
+		}
+	}
+
+	s.log.Debug(
+		"obtained public ip address",
+		zap.String("subsystem", fn),
+		zap.String("app", s.name),
+		zap.Int("ip_version", version),
+		zap.Int("votes", votes[consensusAddr]),
+		zap.Int("sources", participants),
+		zap.Any("address", consensusAddr),
+	)
+	return consensusAddr, nil
+}
+
+// registerRecordAddress compares the provided public IP address to the
+// address in DNS, and registers the record with the provider when the two
+// differ. The addresses rejected by the address policy of the record are
+// never registered. It returns the registration state of the record.
+func registerRecordAddress(s *Server, fn string, provider *RegistrationProvider, r *record.RegistrationRecord, version int, addr string) (string, error) {
+	if err := r.CheckAddress(addr); err != nil {
+		return record.StateFailed, err
+	}
+
+	dnsAddrs, looked, err := lookupRecordAddresses(s, fn, provider, r, version)
+	if err != nil {
+		return record.StateFailed, err
+	}
+	s.log.Debug(
+		"resolved dns record",
+		zap.String("subsystem", fn),
+		zap.String("app", s.name),
+		zap.Int("ip_version", version),
+		zap.Any("record", r),
+		zap.Any("addresses", dnsAddrs),
+	)
+
+	if len(dnsAddrs) == 1 {
+		if dnsAddrs[0] == addr {
+			s.log.Debug(
+				"dns record is up to date",
+				zap.String("subsystem", fn),
+				zap.String("app", s.name),
+				zap.Int("ip_version", version),
+				zap.Any("record", r),
+				zap.Any("public_ip", addr),
+				zap.Any("dns_addresses", dnsAddrs),
+			)
+			return record.StateUpToDate, nil
+		}
+	}
+
+	// Update DNS record could be outdated
+	if err := r.SetAddress(addr, version); err != nil {
+		return record.StateFailed, fmt.Errorf("failed updating internal dns record: %s", err)
+	}
+
+	// The addresses looked up with the provider are passed to the provider,
+	// so that it does not look the record up again.
+	if looked {
+		err = provider.RegisterOutdated(r, version, dnsAddrs)
+	} else {
+		err = provider.Register(r, version)
+	}
+	if err != nil {
+		return record.StateFailed, fmt.Errorf("dns record update failed: %s", err)
+	}
+
+	return record.StateUpdated, nil
+}
+
+// lookupRecordAddresses returns the addresses of the provided IP version
+// associated with DNS A/AAAA record. With the provider lookup, the provider
+// is asked for the addresses, falling back to DNS when the provider does not
+// support lookups. It returns true when the addresses are from the provider.
+func lookupRecordAddresses(s *Server, fn string, provider *RegistrationProvider, r *record.RegistrationRecord, version int) ([]string, bool, error) {
+	if provider.getLookup(s.cfg.Lookup) == lookupProvider {
+		s.log.Debug(
+			"looking up dns record with provider",
+			zap.String("subsystem", fn),
+			zap.String("app", s.name),
+			zap.Int("ip_version", version),
+			zap.Any("record", r),
+		)
+		addrs, err := provider.Lookup(r, version)
+		if err == nil {
+			return addrs, true, nil
+		}
+		if err != providers.ErrLookupNotSupported {
+			return nil, false, fmt.Errorf("dns record lookup failed: %s", err)
+		}
+		s.log.Info(
+			"dns provider does not support lookup, falling back to dns",
+			zap.String("subsystem", fn),
+			zap.String("app", s.name),
+			zap.String("provider", r.Provider),
+			zap.Int("ip_version", version),
+			zap.String("record", r.Name),
+		)
+	}
+
+	s.log.Debug(
+		"resolving dns record",
+		zap.String("subsystem", fn),
+		zap.String("app", s.name),
+		zap.Int("ip_version", version),
+		zap.Any("record", r),
+	)
+	addrs, err := s.cfg.getResolver().Resolve(r.Name, version)
+	if err != nil {
+		return nil, false, fmt.Errorf("resolving dns record failed: %s", err)
+	}
+	return addrs, false, nil
+}
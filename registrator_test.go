@@ -0,0 +1,238 @@
+package dyndns
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/greenpau/dyndns/pkg/record"
+	"github.com/greenpau/dyndns/pkg/sources"
+	"go.uber.org/zap"
+)
+
+// testSource is an address source returning preconfigured addresses.
+type testSource struct {
+	mu    sync.Mutex
+	addrs map[int]string
+	err   error
+	calls int
+}
+
+func (s *testSource) Configure(*zap.Logger) error { return nil }
+func (s *testSource) Validate() error             { return nil }
+func (s *testSource) GetSource() string           { return "test" }
+func (s *testSource) GetVersions() []int {
+	versions := []int{}
+	for _, version := range []int{4, 6} {
+		if _, exists := s.addrs[version]; exists || s.addrs == nil {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+func (s *testSource) GetAddress(version int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.err != nil {
+		return "", s.err
+	}
+	addr, exists := s.addrs[version]
+	if !exists {
+		return "", sources.ErrVersionNotSupported
+	}
+	return addr, nil
+}
+
+func newTestServer(srcs ...sources.Source) *Server {
+	s := NewServer()
+	s.log = zap.NewNop()
+	for _, src := range srcs {
+		s.cfg.AddressSources = append(s.cfg.AddressSources, &AddressSource{source: src})
+	}
+	return s
+}
+
+func TestDiscoverPublicAddress(t *testing.T) {
+	failing := &testSource{err: fmt.Errorf("service unavailable")}
+	ipv6Only := &testSource{addrs: map[int]string{6: "2001:db8::10"}}
+	ipv4 := &testSource{addrs: map[int]string{4: "203.0.113.10"}}
+	s := newTestServer(failing, ipv6Only, ipv4)
+
+	addr, err := discoverPublicAddress(s, "test", 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if addr != "203.0.113.10" {
+		t.Fatalf("unexpected address: %s", addr)
+	}
+	if failing.calls != 1 || ipv6Only.calls != 1 || ipv4.calls != 1 {
+		t.Fatalf("unexpected source calls: %d, %d, %d", failing.calls, ipv6Only.calls, ipv4.calls)
+	}
+
+	addr, err = discoverPublicAddress(s, "test", 6)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if addr != "2001:db8::10" || ipv4.calls != 1 {
+		t.Fatalf("unexpected address %s or source calls %d", addr, ipv4.calls)
+	}
+
+	s = newTestServer(failing, ipv6Only)
+	if _, err := discoverPublicAddress(s, "test", 4); err == nil {
+		t.Fatalf("expected error when all sources fail")
+	}
+}
+
+func TestDiscoverConsensusAddress(t *testing.T) {
+	newSource := func(addr string) *testSource {
+		return &testSource{addrs: map[int]string{4: addr}}
+	}
+	testcases := []struct {
+		name      string
+		sources   []sources.Source
+		quorum    uint64
+		want      string
+		shouldErr bool
+	}{
+		{
+			name:    "all sources agree",
+			sources: []sources.Source{newSource("203.0.113.10"), newSource("203.0.113.10"), newSource("203.0.113.10")},
+			quorum:  3,
+			want:    "203.0.113.10",
+		},
+		{
+			name:    "quorum despite disagreement",
+			sources: []sources.Source{newSource("203.0.113.10"), newSource("10.0.0.1"), newSource("203.0.113.10")},
+			quorum:  2,
+			want:    "203.0.113.10",
+		},
+		{
+			name:    "quorum despite failure",
+			sources: []sources.Source{newSource("203.0.113.10"), &testSource{err: fmt.Errorf("timeout")}, newSource("203.0.113.10")},
+			quorum:  2,
+			want:    "203.0.113.10",
+		},
+		{
+			name:      "quorum not reached",
+			sources:   []sources.Source{newSource("203.0.113.10"), newSource("10.0.0.1"), newSource("203.0.113.10")},
+			quorum:    3,
+			shouldErr: true,
+		},
+		{
+			name:      "split sources",
+			sources:   []sources.Source{newSource("203.0.113.10"), newSource("10.0.0.1"), newSource("10.0.0.1"), newSource("203.0.113.10")},
+			quorum:    2,
+			shouldErr: true,
+		},
+		{
+			name:      "all sources fail",
+			sources:   []sources.Source{&testSource{err: fmt.Errorf("timeout")}},
+			quorum:    1,
+			shouldErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(tc.sources...)
+			s.cfg.AddressQuorum = tc.quorum
+			addr, err := discoverPublicAddress(s, "test", 4)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if addr != tc.want {
+				t.Fatalf("unexpected address: %s (actual) vs. %s (expected)", addr, tc.want)
+			}
+			for _, src := range tc.sources {
+				if src.(*testSource).calls != 1 {
+					t.Fatalf("expected every source to be queried once")
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterRecordAddressPolicy(t *testing.T) {
+	s := newTestServer()
+	engine := &testEngine{}
+	provider := &RegistrationProvider{engine: engine}
+	r := &record.RegistrationRecord{
+		Name:   "app.contoso.com",
+		Policy: &record.AddressPolicy{Deny: []string{"10.0.0.0/8"}, RejectSpecial: true},
+	}
+	if err := r.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %s", err)
+	}
+	state, err := registerRecordAddress(s, "test", provider, r, 4, "10.1.2.3")
+	if err == nil {
+		t.Fatalf("expected address to be rejected by policy")
+	}
+	if state != record.StateFailed {
+		t.Fatalf("unexpected state: %s", state)
+	}
+	if len(engine.registrations) > 0 {
+		t.Fatalf("unexpected registrations: %v", engine.registrations)
+	}
+	if addr, _ := r.GetAddress(4); addr != "" {
+		t.Fatalf("unexpected record address: %s", addr)
+	}
+}
+
+func TestRegisterRecordAddressProviderLookup(t *testing.T) {
+	testcases := []struct {
+		name           string
+		lookup         string
+		providerLookup string
+		addrs          map[int][]string
+		state          string
+		registrations  int
+		shouldErr      bool
+	}{
+		{name: "record is up to date", lookup: lookupProvider, addrs: map[int][]string{4: {"203.0.113.10"}}, state: record.StateUpToDate},
+		{name: "record is outdated", lookup: lookupProvider, addrs: map[int][]string{4: {"198.51.100.1"}}, state: record.StateUpdated, registrations: 1},
+		{name: "record not found", lookup: lookupProvider, addrs: map[int][]string{}, state: record.StateUpdated, registrations: 1},
+		{name: "lookup not supported falls back to dns", lookup: lookupProvider, state: record.StateFailed, shouldErr: true},
+		{name: "provider lookup overrides dns lookup", providerLookup: lookupProvider, addrs: map[int][]string{4: {"198.51.100.1"}}, state: record.StateUpdated, registrations: 1},
+		{name: "dns lookup overrides provider lookup", lookup: lookupProvider, providerLookup: lookupDNS, addrs: map[int][]string{4: {"203.0.113.10"}}, state: record.StateFailed, shouldErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer()
+			s.cfg.Lookup = tc.lookup
+			// The resolver is unreachable, i.e. DNS is used only when the
+			// provider does not support lookups.
+			s.cfg.Resolver = &ResolverConfig{Servers: []string{"127.0.0.1:1"}, Timeout: 1}
+			if err := s.cfg.Resolver.validate(); err != nil {
+				t.Fatal(err)
+			}
+			engine := &testEngine{addrs: tc.addrs}
+			provider := &RegistrationProvider{engine: engine, lookup: tc.providerLookup}
+			r := &record.RegistrationRecord{Name: "app.contoso.com"}
+			r.Validate()
+
+			state, err := registerRecordAddress(s, "test", provider, r, 4, "203.0.113.10")
+			if tc.shouldErr && err == nil {
+				t.Fatalf("expected error")
+			}
+			if !tc.shouldErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if state != tc.state {
+				t.Fatalf("unexpected state: %s (actual) vs. %s (expected)", state, tc.state)
+			}
+			if len(engine.registrations) != tc.registrations {
+				t.Fatalf("unexpected registrations: %v", engine.registrations)
+			}
+			// The addresses looked up are passed to the provider.
+			if len(engine.outdated) != tc.registrations {
+				t.Fatalf("unexpected registrations of outdated records: %v", engine.outdated)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package dyndns
+
+import (
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/utils"
+	"strings"
+	"time"
+)
+
+// defaultResolvConf is the resolver configuration file of the system.
+const defaultResolvConf = "/etc/resolv.conf"
+
+// ResolverConfig is the configuration of the resolver checking whether the
+// records in DNS are up to date. The queries are sent to the listed servers,
+// or to the servers of the system. In the authoritative mode, the queries
+// are sent to the name servers of the zone of a record, always over plain
+// DNS, so the mode is not available with the encrypted transports.
+type ResolverConfig struct {
+	Servers       []string `json:"servers,omitempty" yaml:"servers,omitempty"`
+	System        bool     `json:"system,omitempty" yaml:"system,omitempty"`
+	ResolvConf    string   `json:"resolv_conf,omitempty" yaml:"resolv_conf,omitempty"`
+	Authoritative bool     `json:"authoritative,omitempty" yaml:"authoritative,omitempty"`
+	Timeout       uint64   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	resolver      *utils.Resolver
+}
+
+// validate validates the resolver configuration and initializes the
+// resolver.
+func (c *ResolverConfig) validate() error {
+	if len(c.Servers) > 0 && (c.System || c.ResolvConf != "") {
+		return fmt.Errorf("servers and system resolver are mutually exclusive")
+	}
+	if c.Authoritative {
+		for _, server := range c.Servers {
+			server = strings.ToLower(server)
+			for _, scheme := range []string{"https://", "tls://", "tcp-tls://"} {
+				if strings.HasPrefix(server, scheme) {
+					return fmt.Errorf("authoritative resolver queries name servers over plain dns, encrypted server %s is not supported", server)
+				}
+			}
+		}
+	}
+	timeout := time.Duration(c.Timeout) * time.Second
+	var err error
+	switch {
+	case c.System || c.ResolvConf != "":
+		path := c.ResolvConf
+		if path == "" {
+			path = defaultResolvConf
+		}
+		c.resolver, err = utils.NewSystemResolver(path, c.Authoritative, timeout)
+	case len(c.Servers) > 0:
+		c.resolver, err = utils.NewResolver(c.Servers, c.Authoritative, timeout)
+	default:
+		c.resolver, err = utils.NewResolver(utils.PublicDNSServers, c.Authoritative, timeout)
+	}
+	return err
+}
+
+// getResolver returns the resolver checking whether the records in DNS are
+// up to date.
+func (cfg *Config) getResolver() *utils.Resolver {
+	if cfg.Resolver == nil || cfg.Resolver.resolver == nil {
+		return utils.DefaultResolver
+	}
+	return cfg.Resolver.resolver
+}
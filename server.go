@@ -42,6 +42,13 @@ func (s *Server) Run() error {
 	sybsystemCount++
 	go runRegistrationManager(s, &wg)
 
+	// Dynamic DNS Update Gateway
+	if s.cfg.Gateway != nil {
+		wg.Add(1)
+		sybsystemCount++
+		go runGatewayManager(s, &wg)
+	}
+
 	// Service Management
 	wg.Add(1)
 	go runServiceManager(s, &wg, sybsystemCount)
@@ -1,6 +1,11 @@
 package dyndns
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -15,7 +20,7 @@ func TestServer(t *testing.T) {
 	cfg := server.GetConfig()
 	t.Logf("running configuration: %v", cfg)
 
-	t.Logf("dns record: %v", cfg.Record)
+	t.Logf("dns records: %v", cfg.Records)
 	t.Logf("provider config: %s", cfg.Provider.config)
 
 	if err := server.ValidateConfig(); err != nil {
@@ -24,3 +29,265 @@ func TestServer(t *testing.T) {
 
 	t.Logf("configuration is valid")
 }
+
+func TestServerRecordsAndProviders(t *testing.T) {
+	testcases := []struct {
+		name      string
+		config    string
+		records   []string
+		shouldErr bool
+		// secret must not appear in the error.
+		secret string
+	}{
+		{
+			name: "record and records",
+			config: `{
+  "provider": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"},
+  "record": {"name": "app.contoso.com"},
+  "records": [
+    {"name": "www.contoso.com", "type": "AAAA", "ttl": 300},
+    {"name": "api.contoso.com", "type": "ALL", "provider": "default"}
+  ]
+}`,
+			records: []string{"app.contoso.com", "www.contoso.com", "api.contoso.com"},
+		},
+		{
+			name: "unknown provider reference",
+			config: `{
+  "provider": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"},
+  "records": [{"name": "www.contoso.com", "provider": "foo"}]
+}`,
+			shouldErr: true,
+		},
+		{
+			name: "duplicate record",
+			config: `{
+  "provider": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"},
+  "record": {"name": "www.contoso.com"},
+  "records": [{"name": "www.contoso.com"}]
+}`,
+			shouldErr: true,
+		},
+		{
+			name: "named providers",
+			config: `{
+  "providers": {
+    "public": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"},
+    "partner": {"type": "route53", "zone_id": "Z627GH1M87Y193", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"}
+  },
+  "records": [
+    {"name": "app.contoso.com", "provider": "public"},
+    {"name": "app.contoso.com", "provider": "partner"}
+  ]
+}`,
+			records: []string{"app.contoso.com", "app.contoso.com"},
+		},
+		{
+			name: "missing provider reference with multiple providers",
+			config: `{
+  "providers": {
+    "public": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"},
+    "partner": {"type": "route53", "zone_id": "Z627GH1M87Y193", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"}
+  },
+  "records": [{"name": "app.contoso.com"}]
+}`,
+			shouldErr: true,
+		},
+		{
+			name: "default provider defined twice",
+			config: `{
+  "provider": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"},
+  "providers": {
+    "default": {"type": "route53", "zone_id": "Z627GH1M87Y193", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"}
+  },
+  "records": [{"name": "app.contoso.com"}]
+}`,
+			shouldErr: true,
+		},
+		{
+			name: "unknown provider type",
+			config: `{
+  "provider": {"type": "foo", "api_token": "Zx8vQ2mTk4"},
+  "records": [{"name": "app.contoso.com"}]
+}`,
+			shouldErr: true,
+			secret:    "Zx8vQ2mTk4",
+		},
+		{
+			name: "provider type formatting",
+			config: `{
+  "provider": {
+    "zone_id" : "Z627GH1M87Y192",
+    "type"    :    "route53",
+    "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"
+  },
+  "records": [{"name": "app.contoso.com"}]
+}`,
+			records: []string{"app.contoso.com"},
+		},
+		{
+			name: "address sources",
+			config: `{
+  "provider": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"},
+  "records": [{"name": "app.contoso.com"}],
+  "address_sources": [
+    {"type": "http", "url": "https://checkip.amazonaws.com/", "versions": [4]},
+    {"type": "http", "url": "https://icanhazip.com/"}
+  ]
+}`,
+			records: []string{"app.contoso.com"},
+		},
+		{
+			name: "address quorum of sources providing record versions",
+			config: `{
+  "provider": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"},
+  "records": [{"name": "app.contoso.com", "type": "A"}],
+  "address_sources": [
+    {"type": "http", "url": "https://checkip.amazonaws.com/", "versions": [4]},
+    {"type": "http", "url": "https://icanhazip.com/"},
+    {"type": "http", "url": "https://api6.ipify.org/", "versions": [6]}
+  ],
+  "address_quorum": 2
+}`,
+			records: []string{"app.contoso.com"},
+		},
+		{
+			name: "address quorum exceeds default sources of ip version",
+			config: `{
+  "provider": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"},
+  "records": [{"name": "app.contoso.com", "type": "ALL"}],
+  "address_quorum": 2
+}`,
+			shouldErr: true,
+		},
+		{
+			name: "address quorum exceeds sources of ip version",
+			config: `{
+  "provider": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"},
+  "records": [{"name": "app.contoso.com", "type": "AAAA"}],
+  "address_sources": [
+    {"type": "upnp"},
+    {"type": "http", "url": "https://icanhazip.com/"}
+  ],
+  "address_quorum": 2
+}`,
+			shouldErr: true,
+		},
+		{
+			name: "unknown address source type",
+			config: `{
+  "provider": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"},
+  "records": [{"name": "app.contoso.com"}],
+  "address_sources": [{"type": "foo", "password": "Zx8vQ2mTk4"}]
+}`,
+			shouldErr: true,
+			secret:    "Zx8vQ2mTk4",
+		},
+		{
+			name: "provider lookup",
+			config: `{
+  "providers": {
+    "private": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns", "lookup": "provider"},
+    "public": {"type": "dyndns2", "username": "jsmith", "password": "secret", "lookup": "dns"}
+  },
+  "records": [
+    {"name": "app.contoso.com", "provider": "private"},
+    {"name": "app.contoso.net", "provider": "public"}
+  ]
+}`,
+			records: []string{"app.contoso.com", "app.contoso.net"},
+		},
+		{
+			name: "invalid provider lookup",
+			config: `{
+  "provider": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns", "lookup": "foo"},
+  "records": [{"name": "app.contoso.com"}]
+}`,
+			shouldErr: true,
+		},
+		{
+			name: "authoritative resolver",
+			config: `{
+  "provider": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"},
+  "resolver": {"servers": ["1.1.1.1", "tcp://9.9.9.9"], "authoritative": true},
+  "records": [{"name": "app.contoso.com"}]
+}`,
+			records: []string{"app.contoso.com"},
+		},
+		{
+			name: "authoritative resolver with encrypted servers",
+			config: `{
+  "provider": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"},
+  "resolver": {"servers": ["https://cloudflare-dns.com/dns-query"], "authoritative": true},
+  "records": [{"name": "app.contoso.com"}]
+}`,
+			shouldErr: true,
+		},
+		{
+			name: "no records",
+			config: `{
+  "provider": {"type": "route53", "zone_id": "Z627GH1M87Y192", "credentials": "./assets/conf/.aws/credentials", "profile_name": "dyndns"}
+}`,
+			shouldErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(configFile, []byte(tc.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			server := NewServer()
+			err := server.LoadConfig(configFile)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected error, got success")
+				}
+				if tc.secret != "" && strings.Contains(err.Error(), tc.secret) {
+					t.Fatalf("error discloses secret: %s", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error reading configuration file: %s", err)
+			}
+			if err := server.ValidateConfig(); err != nil {
+				t.Fatalf("error validating configuration file: %s", err)
+			}
+			cfg := server.GetConfig()
+			var records []string
+			for _, r := range cfg.Records {
+				records = append(records, r.Name)
+			}
+			if !reflect.DeepEqual(records, tc.records) {
+				t.Fatalf("unexpected records: %v (actual) vs. %v (expected)", records, tc.records)
+			}
+		})
+	}
+}
+
+func TestServerConfigFormats(t *testing.T) {
+	var configs []string
+	for _, configFile := range []string{"./assets/conf/config.json", "./assets/conf/config.yaml"} {
+		server := NewServer()
+		if err := server.LoadConfig(configFile); err != nil {
+			t.Fatalf("error reading configuration file %s: %s", configFile, err)
+		}
+		if err := server.ValidateConfig(); err != nil {
+			t.Fatalf("error validating configuration file %s: %s", configFile, err)
+		}
+		cfg := server.GetConfig()
+		b, err := json.Marshal(map[string]interface{}{
+			"providers":     cfg.Providers,
+			"records":       cfg.Records,
+			"sync_interval": cfg.SyncInterval,
+		})
+		if err != nil {
+			t.Fatalf("error marshaling configuration %s: %s", configFile, err)
+		}
+		configs = append(configs, string(b))
+	}
+	if configs[0] != configs[1] {
+		t.Fatalf("json and yaml configurations differ:\n%s (json)\n%s (yaml)", configs[0], configs[1])
+	}
+}
@@ -31,6 +31,7 @@ M:
 					zap.String("app", s.name),
 					zap.String("error", err.Error()),
 				)
+				stopProviders(s)
 				for i := 0; i < goRoutineCount; i++ {
 					s.ctx.exitRoutine <- true
 				}
@@ -50,6 +51,7 @@ M:
 				"notifying goroutines in response to graceful shutdown signal",
 				zap.String("app", s.name),
 			)
+			stopProviders(s)
 			for i := 0; i < goRoutineCount; i++ {
 				s.ctx.exitRoutine <- exitNotice
 				s.log.Debug(
@@ -73,6 +75,14 @@ M:
 	return
 }
 
+// stopProviders interrupts the registrations in progress, so that the
+// goroutines waiting for them notice the shutdown.
+func stopProviders(s *Server) {
+	for _, p := range s.cfg.Providers {
+		p.Stop()
+	}
+}
+
 func runSignalManager(s *Server) {
 	sysChannel := make(chan os.Signal, 1)
 	signal.Notify(sysChannel, os.Interrupt, syscall.SIGTERM)
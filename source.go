@@ -0,0 +1,135 @@
+package dyndns
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/greenpau/dyndns/pkg/sources"
+	"go.uber.org/zap"
+)
+
+// newDefaultAddressSources returns the address sources used when none are
+// configured.
+func newDefaultAddressSources() []*AddressSource {
+	return []*AddressSource{
+		{source: sources.NewHTTPSource("https://checkip.amazonaws.com/", 4)},
+		{source: sources.NewHTTPSource("https://api6.ipify.org/", 6)},
+	}
+}
+
+// AddressSource is a source of the public address of the host.
+type AddressSource struct {
+	source sources.Source
+}
+
+// GetAddress returns the address of the provided IP version.
+func (s *AddressSource) GetAddress(version int) (string, error) {
+	return s.source.GetAddress(version)
+}
+
+// GetVersions returns the IP versions of the addresses provided by
+// AddressSource.
+func (s *AddressSource) GetVersions() []int {
+	return s.source.GetVersions()
+}
+
+// GetSource returns the source type associated with AddressSource.
+func (s *AddressSource) GetSource() string {
+	return s.source.GetSource()
+}
+
+// Validate validates AddressSource instance.
+func (s *AddressSource) Validate() error {
+	if s.source == nil {
+		return fmt.Errorf("failed to initialize address source instance")
+	}
+	return s.source.Validate()
+}
+
+// Configure configures AddressSource instance.
+func (s *AddressSource) Configure(logger *zap.Logger) error {
+	if s.source == nil {
+		return fmt.Errorf("failed to initialize address source instance")
+	}
+	return s.source.Configure(logger)
+}
+
+// MarshalJSON packs configuration of AddressSource JSON byte array
+func (s AddressSource) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.source)
+}
+
+// UnmarshalJSON unpacks configuration into appropriate structures.
+func (s *AddressSource) UnmarshalJSON(inputConfig []byte) error {
+	_, source, err := decodeTyped("address source", jsonUnmarshaler(inputConfig), sources.New)
+	if err != nil {
+		return err
+	}
+	s.source = source
+	return nil
+}
+
+// UnmarshalYAML unpacks YAML configuration into appropriate structures.
+func (s *AddressSource) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	_, source, err := decodeTyped("address source", unmarshal, sources.New)
+	if err != nil {
+		return err
+	}
+	s.source = source
+	return nil
+}
+
+// validateAddressSources validates address sources. When none are
+// configured, the default sources are used.
+func (cfg *Config) validateAddressSources() error {
+	if len(cfg.AddressSources) == 0 {
+		cfg.AddressSources = newDefaultAddressSources()
+	}
+	for i, source := range cfg.AddressSources {
+		if source == nil {
+			return fmt.Errorf("address source %d failed to initialize due to invalid configuration", i)
+		}
+		if err := source.Validate(); err != nil {
+			return fmt.Errorf("invalid address source %d definition, error: %s", i, err.Error())
+		}
+	}
+	if cfg.AddressQuorum > uint64(len(cfg.AddressSources)) {
+		return fmt.Errorf("address quorum %d exceeds the number of address sources %d", cfg.AddressQuorum, len(cfg.AddressSources))
+	}
+	// The sources not providing addresses of an IP version do not vote on
+	// the address of the version.
+	for _, version := range cfg.getRecordVersions() {
+		var n uint64
+		for _, source := range cfg.AddressSources {
+			for _, v := range source.GetVersions() {
+				if v == version {
+					n++
+					break
+				}
+			}
+		}
+		if n == 0 {
+			return fmt.Errorf("no address sources provide ipv%d addresses", version)
+		}
+		if cfg.AddressQuorum > n {
+			return fmt.Errorf("address quorum %d exceeds the number of address sources %d providing ipv%d addresses", cfg.AddressQuorum, n, version)
+		}
+	}
+	return nil
+}
+
+// getRecordVersions returns the IP versions of the records.
+func (cfg *Config) getRecordVersions() []int {
+	var v4, v6 bool
+	for _, r := range cfg.Records {
+		v4 = v4 || r.Version4
+		v6 = v6 || r.Version6
+	}
+	versions := []int{}
+	if v4 {
+		versions = append(versions, 4)
+	}
+	if v6 {
+		versions = append(versions, 6)
+	}
+	return versions
+}
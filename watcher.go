@@ -0,0 +1,112 @@
+package dyndns
+
+import (
+	"time"
+
+	"github.com/greenpau/dyndns/pkg/netwatch"
+
+	"go.uber.org/zap"
+)
+
+// minTriggerInterval is the minimum interval between the registrations
+// triggered by the changes of the addresses of local interfaces.
+const minTriggerInterval = 10 * time.Second
+
+// WatchConfig is the configuration of the event-driven detection of the
+// changes of the public address. When enabled, the changes of the addresses
+// of local interfaces trigger registration immediately, while the periodic
+// registration at sync interval remains as the fallback.
+type WatchConfig struct {
+	Netlink    bool     `json:"netlink" yaml:"netlink"`
+	Interfaces []string `json:"interfaces,omitempty" yaml:"interfaces,omitempty"`
+}
+
+// startAddressWatcher subscribes to the changes of the addresses of local
+// interfaces. It returns the channel receiving a value when registration
+// should be triggered. The returned channel is nil when the watcher is
+// disabled or not available.
+func startAddressWatcher(s *Server, fn string, done <-chan struct{}) <-chan struct{} {
+	if s.cfg.Watch == nil || !s.cfg.Watch.Netlink {
+		return nil
+	}
+	events, err := netwatch.Watch(done, s.cfg.Watch.Interfaces)
+	if err != nil {
+		s.log.Warn(
+			"address watcher failed, falling back to polling",
+			zap.String("subsystem", fn),
+			zap.String("app", s.name),
+			zap.String("error", err.Error()),
+		)
+		return nil
+	}
+	s.log.Debug(
+		"started address watcher",
+		zap.String("subsystem", fn),
+		zap.String("app", s.name),
+		zap.Strings("interfaces", s.cfg.Watch.Interfaces),
+	)
+
+	trigger := make(chan struct{}, 1)
+	go func() {
+		coalesceEvents(events, trigger, minTriggerInterval, func(ev netwatch.Event) {
+			s.log.Debug(
+				"detected address change",
+				zap.String("subsystem", fn),
+				zap.String("app", s.name),
+				zap.Any("event", ev),
+			)
+		})
+		select {
+		case <-done:
+		default:
+			s.log.Warn(
+				"address watcher stopped, falling back to polling",
+				zap.String("subsystem", fn),
+				zap.String("app", s.name),
+			)
+		}
+	}()
+	return trigger
+}
+
+// coalesceEvents sends a value to the trigger channel on the address
+// changes received from the events channel. The changes received within the
+// provided interval after a trigger are coalesced into a single trigger,
+// sent when the interval elapses. It returns when the events channel is
+// closed.
+func coalesceEvents(events <-chan netwatch.Event, trigger chan<- struct{}, interval time.Duration, onEvent func(netwatch.Event)) {
+	var last time.Time
+	var pending *time.Timer
+	var pendingC <-chan time.Time
+	fire := func() {
+		last = time.Now()
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				if pending != nil {
+					pending.Stop()
+				}
+				return
+			}
+			onEvent(ev)
+			if pendingC != nil {
+				continue
+			}
+			if wait := interval - time.Since(last); wait > 0 {
+				pending = time.NewTimer(wait)
+				pendingC = pending.C
+				continue
+			}
+			fire()
+		case <-pendingC:
+			pending, pendingC = nil, nil
+			fire()
+		}
+	}
+}
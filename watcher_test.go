@@ -0,0 +1,52 @@
+package dyndns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/greenpau/dyndns/pkg/netwatch"
+)
+
+func TestCoalesceEvents(t *testing.T) {
+	events := make(chan netwatch.Event)
+	trigger := make(chan struct{}, 1)
+	interval := 200 * time.Millisecond
+	stopped := make(chan struct{})
+	var received int
+	go func() {
+		coalesceEvents(events, trigger, interval, func(netwatch.Event) { received++ })
+		close(stopped)
+	}()
+
+	// The first change triggers registration immediately, and the burst
+	// of the following changes triggers a single registration after the
+	// interval.
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		events <- netwatch.Event{Interface: "eth0", Address: "2001:db8::10"}
+	}
+	select {
+	case <-trigger:
+	case <-time.After(interval / 2):
+		t.Fatalf("first change did not trigger registration")
+	}
+	select {
+	case <-trigger:
+		if elapsed := time.Since(start); elapsed < interval {
+			t.Fatalf("coalesced changes triggered registration after %s, before interval %s", elapsed, interval)
+		}
+	case <-time.After(5 * interval):
+		t.Fatalf("coalesced changes did not trigger registration")
+	}
+	select {
+	case <-trigger:
+		t.Fatalf("unexpected trigger")
+	case <-time.After(2 * interval):
+	}
+
+	close(events)
+	<-stopped
+	if received != 5 {
+		t.Fatalf("unexpected number of events: %d", received)
+	}
+}